@@ -22,6 +22,7 @@ func init() {
 	rootCmd.AddCommand(configCmd)
 	// Add flags
 	initConfigFlags(configCmd)
+	initServerFlags(configCmd)
 	configCmd.Flags().StringVarP(&outputType, "type", "t", "all", "Output type (all, config, deployment, rbac, extension)")
 }
 
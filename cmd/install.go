@@ -2,19 +2,34 @@ package cmd
 
 import (
 	"log/slog"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/bakito/argocd-touch-extension/internal/extension"
 	"github.com/bakito/argocd-touch-extension/internal/install"
+	"github.com/bakito/argocd-touch-extension/internal/k8s"
 	"github.com/spf13/cobra"
 )
 
 var (
-	grace      bool
-	installCmd = &cobra.Command{
+	grace       bool
+	watch       bool
+	installOpts install.Options
+	installCmd  = &cobra.Command{
 		Use:   "install",
 		Short: "Install the UI extension to argocd server",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			err := install.Do(cmd.Context())
-			if err != nil && !grace {
+			if watch {
+				ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGINT, syscall.SIGTERM)
+				defer stop()
+				return install.Watch(ctx, installOpts)
+			}
+			err := installExtension(cmd)
+			if err == nil {
+				return nil
+			}
+			if !grace {
 				return err
 			}
 			slog.ErrorContext(cmd.Context(), "Extension installation failed, but continuing", "error", err)
@@ -26,4 +41,51 @@ var (
 func init() {
 	rootCmd.AddCommand(installCmd)
 	installCmd.Flags().BoolVarP(&grace, "graceful", "g", false, "Continues normally if there is an error")
+	installCmd.Flags().StringVar(&installOpts.PublicKey, "public-key", "",
+		"ed25519 public key (PEM or base64) the extension must be signed with, defaults to $EXTENSION_PUBLIC_KEY")
+	installCmd.Flags().BoolVar(&installOpts.Archive, "archive", false,
+		"Install all files of extension.tar.gz instead of the script only")
+	installCmd.Flags().DurationVar(&installOpts.Timeout, "timeout", 5*time.Minute,
+		"Total deadline of the installation including retries (0 disables the deadline)")
+	installCmd.Flags().DurationVar(&installOpts.Backoff, "backoff", time.Second,
+		"Delay before retrying a failed download, doubled with each retry up to 30s")
+	installCmd.Flags().StringVar(&installOpts.ReadyURL, "ready-url", "",
+		"URL polled until the server is ready before downloading, defaults to $EXTENSION_READY_URL")
+	installCmd.Flags().StringVar(&installOpts.File, "from-file", "",
+		"Install a local extension-touch.js or extension.tar.gz, verified with extension_checksum.txt of its directory")
+	installCmd.Flags().StringVarP(&configFile, "config", "c", "",
+		"Render the extension locally from the touch config file instead of downloading it")
+	initTemplateFlags(installCmd)
+	installCmd.Flags().StringVar(&signingKeyFile, "signing-key-file", "",
+		"PEM encoded ed25519 private key to sign the locally rendered extension with")
+	installCmd.Flags().BoolVar(&watch, "watch", false,
+		"Run as sidecar and install the extension again whenever it changes on the server")
+	installCmd.Flags().DurationVar(&installOpts.Interval, "interval", 30*time.Second,
+		"Delay between two checks for changes with --watch")
+	installCmd.Flags().StringVar(&installOpts.CAFile, "ca-file", "",
+		"PEM bundle of CAs trusted in addition to the system roots for downloads, defaults to $EXTENSION_CA_FILE")
+	installCmd.Flags().StringVar(&installOpts.ClientCertFile, "client-cert-file", "",
+		"Client certificate presented to the server, defaults to $EXTENSION_CLIENT_CERT_FILE")
+	installCmd.Flags().StringVar(&installOpts.ClientKeyFile, "client-key-file", "",
+		"Key of the client certificate, defaults to $EXTENSION_CLIENT_KEY_FILE")
+	installCmd.Flags().StringVar(&installOpts.TokenFile, "token-file", "",
+		"File with a bearer token sent with each download, defaults to $EXTENSION_TOKEN_FILE or the token $EXTENSION_TOKEN")
+	installCmd.Flags().StringVar(&installOpts.Proxy, "proxy", "",
+		"Proxy URL for downloads, defaults to $EXTENSION_PROXY, then $HTTPS_PROXY, $HTTP_PROXY and $NO_PROXY")
+	installCmd.MarkFlagsMutuallyExclusive("from-file", "config", "watch")
+}
+
+// installExtension installs the extension, rendered locally if a config file is set.
+func installExtension(cmd *cobra.Command) error {
+	if configFile != "" {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		// rendered without API server, the installed script and archive do not depend on the name and version
+		if installOpts.Extension, err = extension.New(cfg, k8s.StaticResolver{}, cfg.ExtensionTemplate); err != nil {
+			return err
+		}
+	}
+	return install.Do(cmd.Context(), installOpts)
 }
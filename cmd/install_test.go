@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bakito/argocd-touch-extension/internal/extension"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstallConfig(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("EXTENSION_INSTALLATION_DIR", dir)
+
+	// the sample config sets no name and version, the extension is rendered without API server
+	rootCmd.SetArgs([]string{"install", "--config", "../touch-resources.yaml"})
+	require.NoError(t, rootCmd.ExecuteContext(t.Context()))
+
+	js, err := os.ReadFile(filepath.Join(dir, "touch", extension.ExtensionJS))
+	require.NoError(t, err)
+	assert.Contains(t, string(js), "Touch Pod")
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"log/slog"
 	"os"
+	"time"
 
 	"github.com/bakito/argocd-touch-extension/internal/app"
 	"github.com/bakito/argocd-touch-extension/internal/config"
+	"github.com/bakito/argocd-touch-extension/internal/leader"
 	"github.com/bakito/argocd-touch-extension/internal/version"
 	"github.com/spf13/cobra"
 )
@@ -21,6 +23,21 @@ var (
 	configFile        string
 	serviceAddress    string
 	extensionTemplate string
+	notificationsFile string
+	userRateLimit     int
+	userRateBurst     int
+	patchAttempts     int
+	patchBackoff      time.Duration
+	dryRun            bool
+	leaderElect       bool
+	leaseName         string
+	leaseNamespace    string
+	listenAddress     string
+	adminAddress      string
+	tlsCertFile       string
+	tlsKeyFile        string
+	tlsClientCAFile   string
+	signingKeyFile    string
 	debug             bool
 )
 
@@ -35,18 +52,53 @@ func Execute() {
 
 func init() {
 	initConfigFlags(rootCmd)
+	initServerFlags(rootCmd)
+	rootCmd.Flags().StringVar(&listenAddress, "listen-address", ":8080", "Address the server listens on")
+	rootCmd.Flags().StringVar(&adminAddress, "admin-address", ":8081",
+		"Address of the admin server for health, metrics, pprof and config dump (empty disables it)")
+	rootCmd.Flags().StringVar(&notificationsFile, "notifications", "", "Location of the notifications config file")
+	rootCmd.Flags().IntVar(&userRateLimit, "user-rate-limit", 0, "Max touches per user and minute (0 disables the limit)")
+	rootCmd.Flags().IntVar(&userRateBurst, "user-rate-burst", 5, "Number of touches a user may perform at once")
+	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Patch all resources in dry run mode")
+	initRetryFlags(rootCmd)
+	rootCmd.Flags().BoolVar(&leaderElect, "leader-elect", true, "Run background tasks only on the replica holding the lease")
+	rootCmd.Flags().
+		StringVar(&leaseName, "leader-election-id", leader.DefaultLeaseName, "Name of the leader election lease")
+	rootCmd.Flags().StringVar(&leaseNamespace, "leader-election-namespace", "",
+		"Namespace of the leader election lease (defaults to the pod namespace)")
+}
+
+func initRetryFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&patchAttempts, "patch-attempts", 3, "Max attempts of a patch on transient api server errors")
+	cmd.Flags().DurationVar(&patchBackoff, "patch-backoff", 200*time.Millisecond,
+		"Delay before retrying a failed patch, doubled with each retry")
 }
 
 func initConfigFlags(cmd *cobra.Command) {
-	cmd.Flags().StringVar(&extensionTemplate, "extension-template", "", "Allows overwriting the UI extension template.")
-	//nolint:revive // http is ok for service address
-	cmd.Flags().
-		StringVar(&serviceAddress, "service-address", "http://argo-cd-touch-extension.svc.cluster.local:8080", "Service address")
+	initTemplateFlags(cmd)
 	cmd.Flags().StringVarP(&configFile, "config", "c", "", "Location of the config file")
 	cmd.Flags().BoolVar(&debug, "debug", false, "Enable debug logging")
 	_ = cmd.MarkFlagRequired("config")
 }
 
+// initTemplateFlags adds the flags rendering the UI extension depends on.
+func initTemplateFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&extensionTemplate, "extension-template", "",
+		"Allows overwriting the UI extension template, a directory is packaged as multi-file bundle.")
+	//nolint:revive // http is ok for service address
+	cmd.Flags().StringVar(&serviceAddress, "service-address",
+		"http://argo-cd-touch-extension.svc.cluster.local:8080", "Service address")
+}
+
+func initServerFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&tlsCertFile, "tls-cert-file", "", "TLS certificate file, enables https (reloaded on change)")
+	cmd.Flags().StringVar(&tlsKeyFile, "tls-key-file", "", "TLS private key file (reloaded on change)")
+	cmd.Flags().StringVar(&tlsClientCAFile, "tls-client-ca-file", "",
+		"CA bundle to verify client certificates, requires a client certificate for the touch API")
+	cmd.Flags().StringVar(&signingKeyFile, "signing-key-file", "",
+		"PEM encoded ed25519 private key to sign the extension assets with")
+}
+
 func runRoot(cmd *cobra.Command, _ []string) error {
 	cfg, err := loadConfig()
 	if err != nil {
@@ -66,7 +118,25 @@ func loadConfig() (config.TouchConfig, error) {
 	if err != nil {
 		return config.TouchConfig{}, err
 	}
-	cfg.ServiceAddress = serviceAddress
+	cfg.Server = config.Server{
+		ListenAddress: listenAddress,
+		AdminAddress:  adminAddress,
+		TLS:           config.TLS{CertFile: tlsCertFile, KeyFile: tlsKeyFile, ClientCAFile: tlsClientCAFile},
+	}
+	if err := cfg.Server.TLS.Validate(); err != nil {
+		return config.TouchConfig{}, err
+	}
+	cfg.ServiceAddress = cfg.Server.TLS.ServiceAddress(serviceAddress)
 	cfg.ExtensionTemplate = extensionTemplate
+	cfg.SigningKeyFile = signingKeyFile
+	cfg.RateLimit = config.RateLimit{UserPerMinute: userRateLimit, UserBurst: userRateBurst}
+	cfg.Retry = config.Retry{Attempts: patchAttempts, Backoff: config.Duration{Duration: patchBackoff}}
+	cfg.DryRun = dryRun
+	cfg.LeaderElection = config.LeaderElection{Enabled: leaderElect, LeaseName: leaseName, Namespace: leaseNamespace}
+	if notificationsFile != "" {
+		if cfg.Notifications, err = config.LoadNotifications(notificationsFile, cfg.Resources); err != nil {
+			return config.TouchConfig{}, err
+		}
+	}
 	return cfg, nil
 }
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"github.com/bakito/argocd-touch-extension/internal/app"
+	"github.com/bakito/argocd-touch-extension/internal/k8s"
+	"github.com/spf13/cobra"
+)
+
+var (
+	touchCmd = &cobra.Command{
+		Use:   "touch <resource> <namespace> <name>",
+		Short: "Touch a single object of a configured resource",
+		Args:  cobra.ExactArgs(3),
+		RunE:  runTouch,
+	}
+
+	// flags.
+	touchUser string
+)
+
+func init() {
+	rootCmd.AddCommand(touchCmd)
+	initConfigFlags(touchCmd)
+	touchCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Patch the object in dry run mode")
+	initRetryFlags(touchCmd)
+	touchCmd.Flags().StringVarP(&touchUser, "user", "u", "", "User recorded in the touch annotation")
+}
+
+func runTouch(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	application, err := app.New(cmd.Context(), cfg)
+	if err != nil {
+		return err
+	}
+
+	result, err := application.Touch(cmd.Context(), args[0], args[1], args[2], touchUser)
+	if err != nil {
+		return err
+	}
+	obj := result.Object
+
+	msg := "Touched"
+	if dryRun {
+		msg = "Touched (dry run)"
+	}
+	cmd.Printf("%s %s %s/%s: %s (resourceVersion %s, %d attempts)\n", msg, obj.GetKind(), obj.GetNamespace(),
+		obj.GetName(), obj.GetAnnotations()[k8s.AnnotationTouch], obj.GetResourceVersion(), result.Attempts)
+	return nil
+}
@@ -0,0 +1,18 @@
+package cmd
+
+import (
+	"github.com/bakito/argocd-touch-extension/internal/install"
+	"github.com/spf13/cobra"
+)
+
+var uninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Remove the UI extension from argocd server",
+	RunE: func(_ *cobra.Command, _ []string) error {
+		return install.Uninstall()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(uninstallCmd)
+}
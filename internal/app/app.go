@@ -2,16 +2,23 @@ package app
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
 
 	"github.com/bakito/argocd-touch-extension/internal/config"
 	"github.com/bakito/argocd-touch-extension/internal/extension"
 	"github.com/bakito/argocd-touch-extension/internal/k8s"
+	"github.com/bakito/argocd-touch-extension/internal/leader"
+	"github.com/bakito/argocd-touch-extension/internal/notify"
+	"github.com/bakito/argocd-touch-extension/internal/scheduler"
 	"github.com/bakito/argocd-touch-extension/internal/server"
 )
 
 type Application struct {
-	client k8s.Client
-	config config.TouchConfig
+	client   k8s.Client
+	config   config.TouchConfig
+	notifier notify.Notifier
+	elector  *leader.Elector
 }
 
 func New(ctx context.Context, cfg config.TouchConfig) (*Application, error) {
@@ -20,9 +27,16 @@ func New(ctx context.Context, cfg config.TouchConfig) (*Application, error) {
 		return nil, err
 	}
 
+	notifier, err := notify.New(cfg.Notifications)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Application{
-		client: client,
-		config: cfg,
+		client:   client,
+		config:   cfg,
+		notifier: notifier,
+		elector:  leader.New(cfg.LeaderElection),
 	}, nil
 }
 
@@ -32,9 +46,56 @@ func (a *Application) Run(ctx context.Context, debug bool) error {
 		return err
 	}
 
-	return server.Run(ctx, a.client, ext, debug)
+	sched, err := scheduler.New(a.client, a.notifier, ext.Resources(), a.touchOptions())
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go a.notifier.Run(ctx)
+
+	go func() {
+		if err := a.elector.Run(ctx, a.backgroundSubsystems(sched)...); err != nil {
+			slog.ErrorContext(ctx, "Leader election failed, background subsystems are not running", "error", err)
+		}
+	}()
+
+	return server.Run(ctx, a.client, ext, a.notifier, server.Options{
+		Debug:     debug,
+		Config:    a.config,
+		Scheduler: sched,
+		Leader:    a.elector,
+	})
+}
+
+// backgroundSubsystems returns the subsystems that must only run on a single replica.
+func (*Application) backgroundSubsystems(sched *scheduler.Scheduler) []leader.Subsystem {
+	var subsystems []leader.Subsystem
+	if !sched.Empty() {
+		subsystems = append(subsystems, sched.Run)
+	}
+	return subsystems
 }
 
 func (a *Application) Extension() (extension.Extension, error) {
 	return extension.New(a.config, a.client, a.config.ExtensionTemplate)
 }
+
+// Touch touches a single object of the resource with the given key.
+func (a *Application) Touch(ctx context.Context, key, namespace, name, user string) (k8s.TouchResult, error) {
+	res, ok := a.config.Resources[key]
+	if !ok {
+		return k8s.TouchResult{}, fmt.Errorf("unknown resource %q", key)
+	}
+	resources, err := a.client.SetNameAndVersion(config.Resources{key: res})
+	if err != nil {
+		return k8s.TouchResult{}, err
+	}
+	return k8s.Touch(ctx, a.client, resources[key], namespace, name, user, a.touchOptions())
+}
+
+func (a *Application) touchOptions() k8s.TouchOptions {
+	return k8s.TouchOptions{DryRun: a.config.DryRun, Retry: a.config.Retry}
+}
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestDuration_Unmarshal(t *testing.T) {
+	var fromYAML Resource
+	if err := yaml.Unmarshal([]byte("cooldown: 30s"), &fromYAML); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fromYAML.Cooldown.Duration != 30*time.Second {
+		t.Errorf("expected 30s, got %v", fromYAML.Cooldown.Duration)
+	}
+
+	var fromJSON Resource
+	if err := json.Unmarshal([]byte(`{"cooldown": "1m"}`), &fromJSON); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fromJSON.Cooldown.Duration != time.Minute {
+		t.Errorf("expected 1m, got %v", fromJSON.Cooldown.Duration)
+	}
+
+	if err := yaml.Unmarshal([]byte("cooldown: soon"), &fromYAML); err == nil {
+		t.Error("expected error for invalid duration")
+	}
+}
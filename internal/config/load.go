@@ -10,25 +10,42 @@ import (
 )
 
 func Load(fileName string) (TouchConfig, error) {
+	var config TouchConfig
+	if err := unmarshalFile(fileName, &config.Resources); err != nil {
+		return TouchConfig{}, err
+	}
+
+	return config, config.Resources.validate()
+}
+
+// LoadNotifications reads the notification targets and validates them against the given resources.
+func LoadNotifications(fileName string, resources Resources) (Notifications, error) {
+	var notifications Notifications
+	if err := unmarshalFile(fileName, &notifications); err != nil {
+		return Notifications{}, err
+	}
+
+	return notifications, notifications.validate(resources)
+}
+
+func unmarshalFile(fileName string, target any) error {
 	data, err := os.ReadFile(fileName)
 	if err != nil {
-		return TouchConfig{}, fmt.Errorf("failed to read config file: %w", err)
+		return fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	var config TouchConfig
 	ext := filepath.Ext(fileName)
 	switch ext {
 	case ".json":
-		if err := json.Unmarshal(data, &config.Resources); err != nil {
-			return TouchConfig{}, fmt.Errorf("failed to parse JSON config: %w", err)
+		if err := json.Unmarshal(data, target); err != nil {
+			return fmt.Errorf("failed to parse JSON config: %w", err)
 		}
 	case ".yaml", ".yml":
-		if err := yaml.Unmarshal(data, &config.Resources); err != nil {
-			return TouchConfig{}, fmt.Errorf("failed to parse YAML config: %w", err)
+		if err := yaml.Unmarshal(data, target); err != nil {
+			return fmt.Errorf("failed to parse YAML config: %w", err)
 		}
 	default:
-		return TouchConfig{}, fmt.Errorf("unsupported file format: %s", ext)
+		return fmt.Errorf("unsupported file format: %s", ext)
 	}
-
-	return config, config.Resources.validateKeys()
+	return nil
 }
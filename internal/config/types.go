@@ -1,8 +1,11 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
+	"slices"
+	"strings"
 )
 
 var keyPattern = regexp.MustCompile("^[A-Za-z0-9_]{2,}$")
@@ -10,11 +13,107 @@ var keyPattern = regexp.MustCompile("^[A-Za-z0-9_]{2,}$")
 type TouchConfig struct {
 	ServiceAddress    string
 	ExtensionTemplate string
-	Resources         Resources
+	// SigningKeyFile is a PEM encoded ed25519 private key, the extension assets are signed with if set.
+	SigningKeyFile string
+	Resources      Resources
+	Notifications  Notifications
+	RateLimit      RateLimit
+	Retry          Retry
+	LeaderElection LeaderElection
+	Server         Server
+	DryRun         bool
+}
+
+type Server struct {
+	// ListenAddress is the address the server listens on, defaults to ":8080".
+	ListenAddress string `json:"listenAddress" yaml:"listenAddress"`
+	// AdminAddress is the address of the internal server for health, metrics, pprof and the config dump,
+	// empty serves the health endpoints on the listen address.
+	AdminAddress string `json:"adminAddress" yaml:"adminAddress"`
+	TLS          TLS    `json:"tls"          yaml:"tls"`
+}
+
+type TLS struct {
+	CertFile string `json:"certFile,omitempty" yaml:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"  yaml:"keyFile,omitempty"`
+	// ClientCAFile enables the verification of client certificates for the touch API.
+	ClientCAFile string `json:"clientCAFile,omitempty" yaml:"clientCAFile,omitempty"`
+}
+
+// Enabled returns true if a certificate is configured.
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+func (t TLS) Validate() error {
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return errors.New("tls requires both a certificate and a key file")
+	}
+	if t.ClientCAFile != "" && !t.Enabled() {
+		return errors.New("client certificate verification requires tls")
+	}
+	return nil
+}
+
+// ServiceAddress returns the address the extension is reachable at, switching to https if tls is enabled.
+func (t TLS) ServiceAddress(address string) string {
+	if t.Enabled() {
+		if rest, ok := strings.CutPrefix(address, "http://"); ok {
+			return "https://" + rest
+		}
+	}
+	return address
+}
+
+type LeaderElection struct {
+	// Enabled lets only the replica holding the lease run background tasks like schedules.
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// LeaseName is the name of the lease, defaults to the application name.
+	LeaseName string `json:"leaseName,omitempty" yaml:"leaseName,omitempty"`
+	// Namespace of the lease, defaults to the namespace of the pod.
+	Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+}
+
+type Retry struct {
+	// Attempts is the max number of patch attempts on transient errors and conflicts, values below 1 disable retries.
+	Attempts int `json:"attempts" yaml:"attempts"`
+	// Backoff is the delay before the first retry, it doubles with each further retry.
+	Backoff Duration `json:"backoff" yaml:"backoff"`
+}
+
+type RateLimit struct {
+	// UserPerMinute is the number of touches a single user may perform per minute, 0 disables the limit.
+	UserPerMinute int `json:"userPerMinute" yaml:"userPerMinute"`
+	// UserBurst is the number of touches a user may perform at once before being limited.
+	UserBurst int `json:"userBurst" yaml:"userBurst"`
 }
 
 type Resources map[string]Resource
 
+func (r Resources) validate() error {
+	if err := r.validateKeys(); err != nil {
+		return err
+	}
+	for key, res := range r {
+		if res.WaitFor != nil {
+			if err := res.WaitFor.validate(); err != nil {
+				return fmt.Errorf("resource %q: %w", key, err)
+			}
+		}
+		names := make(map[string]bool)
+		for _, s := range res.Schedules {
+			if s.Name == "" || s.Cron == "" || s.Selector == "" {
+				return fmt.Errorf("resource %q: schedules require name, cron and selector", key)
+			}
+			if names[s.Name] {
+				return fmt.Errorf("resource %q: duplicate schedule %q", key, s.Name)
+			}
+			names[s.Name] = true
+		}
+	}
+	return nil
+}
+
 func (r Resources) validateKeys() error {
 	for key := range r {
 		if !keyPattern.MatchString(key) {
@@ -30,9 +129,139 @@ type Resource struct {
 	Kind        string       `json:"kind"                  yaml:"kind"`
 	Name        string       `json:"name"                  yaml:"name"`
 	UIExtension *UIExtension `json:"uiExtension,omitempty" yaml:"uiExtension,omitempty"`
+	// Cooldown is the minimum time between two touches of the same object.
+	Cooldown Duration `json:"cooldown,omitzero" yaml:"cooldown,omitempty"`
+	// HistoryLimit is the number of touches kept in the history annotation, 0 disables the history.
+	HistoryLimit int `json:"historyLimit,omitempty" yaml:"historyLimit,omitempty"`
+	// WaitFor lets touches wait until the controller reconciled the object.
+	WaitFor *WaitFor `json:"waitFor,omitempty" yaml:"waitFor,omitempty"`
+	// Schedules touch all objects matching a label selector periodically.
+	Schedules []Schedule `json:"schedules,omitempty" yaml:"schedules,omitempty"`
+	// Notify lists the names of the notification targets informed about touches of this resource.
+	Notify []string `json:"notify,omitempty" yaml:"notify,omitempty"`
+}
+
+// WaitFor defines how to detect that a touched object was reconciled. Exactly one criterion must be set.
+type WaitFor struct {
+	// Condition waits until the status condition of the given type has the given status.
+	// It fails if the condition changes to False while waiting for True or vice versa, other changes are awaited.
+	Condition *WaitCondition `json:"condition,omitempty" yaml:"condition,omitempty"`
+	// Field waits until the value of the field, e.g. "status.refreshTime", changes.
+	Field string `json:"field,omitempty" yaml:"field,omitempty"`
+	// ObservedGeneration waits until status.observedGeneration reaches the generation of the object
+	// and the status was written after the touch.
+	ObservedGeneration bool `json:"observedGeneration,omitempty" yaml:"observedGeneration,omitempty"`
+	// ResourceVersion waits until the object is modified after the touch.
+	ResourceVersion bool `json:"resourceVersion,omitempty" yaml:"resourceVersion,omitempty"`
+	// Timeout is the max duration to wait, defaults to 30s.
+	Timeout Duration `json:"timeout,omitzero" yaml:"timeout,omitempty"`
+}
+
+type WaitCondition struct {
+	Type   string `json:"type"   yaml:"type"`
+	Status string `json:"status" yaml:"status"`
+}
+
+func (w *WaitFor) validate() error {
+	criteria := 0
+	if w.Condition != nil {
+		if w.Condition.Type == "" || w.Condition.Status == "" {
+			return errors.New("waitFor condition requires type and status")
+		}
+		criteria++
+	}
+	if w.Field != "" {
+		criteria++
+	}
+	if w.ObservedGeneration {
+		criteria++
+	}
+	if w.ResourceVersion {
+		criteria++
+	}
+	if criteria != 1 {
+		return errors.New("waitFor requires exactly one of condition, field, observedGeneration or resourceVersion")
+	}
+	return nil
+}
+
+// Schedule touches the objects matching the selector according to the cron expression.
+type Schedule struct {
+	Name string `json:"name" yaml:"name"`
+	// Cron is a standard cron expression, e.g. "0 2 * * *", or a descriptor like "@hourly".
+	Cron string `json:"cron" yaml:"cron"`
+	// Selector is a label selector, e.g. "refresh=nightly".
+	Selector string `json:"selector" yaml:"selector"`
+	// Namespaces restricts the schedule to the given namespaces, defaults to all namespaces.
+	Namespaces []string `json:"namespaces,omitempty" yaml:"namespaces,omitempty"`
 }
 
 type UIExtension struct {
 	TabTitle string `json:"tabTitle,omitempty" yaml:"tabTitle,omitempty"`
 	Icon     string `json:"icon,omitempty"     yaml:"icon,omitempty"`
 }
+
+type NotificationType string
+
+const (
+	NotificationTypeWebhook NotificationType = "webhook"
+	NotificationTypeSlack   NotificationType = "slack"
+	NotificationTypeTeams   NotificationType = "teams"
+)
+
+type NotificationEvent string
+
+const (
+	NotificationEventSuccess NotificationEvent = "success"
+	NotificationEventFailure NotificationEvent = "failure"
+)
+
+type Notifications struct {
+	// QueueSize is the number of pending notifications per target, further notifications are dropped.
+	QueueSize int `json:"queueSize,omitempty" yaml:"queueSize,omitempty"`
+	// Retries is the number of retries for a failed notification.
+	Retries int                           `json:"retries,omitempty" yaml:"retries,omitempty"`
+	Targets map[string]NotificationTarget `json:"targets,omitempty" yaml:"targets,omitempty"`
+}
+
+type NotificationTarget struct {
+	Type NotificationType `json:"type"              yaml:"type"`
+	// URL of the webhook, environment variables are expanded.
+	URL string `json:"url" yaml:"url"`
+	// Headers are added to the request, environment variables in values are expanded.
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	// Template is the JSON body for webhook targets and the message text for slack and teams targets.
+	Template string `json:"template,omitempty" yaml:"template,omitempty"`
+	// Events the target is notified about, defaults to all.
+	Events []NotificationEvent `json:"events,omitempty" yaml:"events,omitempty"`
+}
+
+func (t NotificationTarget) Wants(event NotificationEvent) bool {
+	return len(t.Events) == 0 || slices.Contains(t.Events, event)
+}
+
+func (n Notifications) validate(resources Resources) error {
+	for name, target := range n.Targets {
+		switch target.Type {
+		case NotificationTypeWebhook, NotificationTypeSlack, NotificationTypeTeams:
+		default:
+			return fmt.Errorf("notification target %q has unsupported type %q", name, target.Type)
+		}
+		if target.URL == "" {
+			return fmt.Errorf("notification target %q has no url", name)
+		}
+		for _, e := range target.Events {
+			if e != NotificationEventSuccess && e != NotificationEventFailure {
+				return fmt.Errorf("notification target %q has unsupported event %q", name, e)
+			}
+		}
+	}
+	for key, res := range resources {
+		for _, name := range res.Notify {
+			if _, ok := n.Targets[name]; !ok {
+				return fmt.Errorf("resource %q references unknown notification target %q", key, name)
+			}
+		}
+	}
+	return nil
+}
@@ -56,3 +56,149 @@ func TestResources_validateKeys(t *testing.T) {
 		})
 	}
 }
+
+func TestNotifications_validate(t *testing.T) {
+	tests := []struct {
+		name          string
+		notifications Notifications
+		resources     Resources
+		expectError   bool
+	}{
+		{
+			name: "valid targets",
+			notifications: Notifications{Targets: map[string]NotificationTarget{
+				"hook": {Type: NotificationTypeWebhook, URL: "http://hook"},
+				"slack": {
+					Type:   NotificationTypeSlack,
+					URL:    "http://slack",
+					Events: []NotificationEvent{NotificationEventFailure},
+				},
+			}},
+			resources:   Resources{"es": Resource{Notify: []string{"hook", "slack"}}},
+			expectError: false,
+		},
+		{
+			name:          "unsupported type",
+			notifications: Notifications{Targets: map[string]NotificationTarget{"mail": {Type: "mail", URL: "http://mail"}}},
+			expectError:   true,
+		},
+		{
+			name:          "missing url",
+			notifications: Notifications{Targets: map[string]NotificationTarget{"teams": {Type: NotificationTypeTeams}}},
+			expectError:   true,
+		},
+		{
+			name: "unsupported event",
+			notifications: Notifications{Targets: map[string]NotificationTarget{
+				"hook": {Type: NotificationTypeWebhook, URL: "http://hook", Events: []NotificationEvent{"started"}},
+			}},
+			expectError: true,
+		},
+		{
+			name:        "unknown target referenced",
+			resources:   Resources{"es": Resource{Notify: []string{"hook"}}},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.notifications.validate(tt.resources)
+			if (err != nil) != tt.expectError {
+				t.Errorf("validate() error = %v, expectError %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestWaitFor_validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		waitFor     WaitFor
+		expectError bool
+	}{
+		{name: "condition", waitFor: WaitFor{Condition: &WaitCondition{Type: "Ready", Status: "True"}}},
+		{name: "field", waitFor: WaitFor{Field: "status.refreshTime"}},
+		{name: "observed generation", waitFor: WaitFor{ObservedGeneration: true}},
+		{name: "resource version", waitFor: WaitFor{ResourceVersion: true}},
+		{name: "incomplete condition", waitFor: WaitFor{Condition: &WaitCondition{Type: "Ready"}}, expectError: true},
+		{name: "no criterion", waitFor: WaitFor{}, expectError: true},
+		{name: "multiple criteria", waitFor: WaitFor{Field: "status.refreshTime", ResourceVersion: true}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.waitFor.validate()
+			if (err != nil) != tt.expectError {
+				t.Errorf("validate() error = %v, expectError %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestResources_validateSchedules(t *testing.T) {
+	tests := []struct {
+		name        string
+		schedules   []Schedule
+		expectError bool
+	}{
+		{
+			name: "valid",
+			schedules: []Schedule{
+				{Name: "nightly", Cron: "0 2 * * *", Selector: "refresh=nightly"},
+				{Name: "hourly", Cron: "@hourly", Selector: "refresh=hourly", Namespaces: []string{"a"}},
+			},
+		},
+		{name: "missing name", schedules: []Schedule{{Cron: "@hourly", Selector: "a=b"}}, expectError: true},
+		{name: "missing cron", schedules: []Schedule{{Name: "nightly", Selector: "a=b"}}, expectError: true},
+		{name: "missing selector", schedules: []Schedule{{Name: "nightly", Cron: "@hourly"}}, expectError: true},
+		{
+			name: "duplicate name",
+			schedules: []Schedule{
+				{Name: "nightly", Cron: "@daily", Selector: "a=b"},
+				{Name: "nightly", Cron: "@hourly", Selector: "a=c"},
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Resources{"cm": Resource{Schedules: tt.schedules}}.validate()
+			if (err != nil) != tt.expectError {
+				t.Errorf("validate() error = %v, expectError %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestTLS(t *testing.T) {
+	tests := []struct {
+		name        string
+		tls         TLS
+		expectError bool
+		address     string
+	}{
+		{name: "disabled", address: "http://touch:8080"},
+		{name: "enabled", tls: TLS{CertFile: "tls.crt", KeyFile: "tls.key"}, address: "https://touch:8080"},
+		{
+			name:    "mtls",
+			tls:     TLS{CertFile: "tls.crt", KeyFile: "tls.key", ClientCAFile: "ca.crt"},
+			address: "https://touch:8080",
+		},
+		{name: "missing key", tls: TLS{CertFile: "tls.crt"}, expectError: true, address: "https://touch:8080"},
+		{name: "client ca without tls", tls: TLS{ClientCAFile: "ca.crt"}, expectError: true, address: "http://touch:8080"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.tls.Validate()
+			if (err != nil) != tt.expectError {
+				t.Errorf("Validate() error = %v, expectError %v", err, tt.expectError)
+			}
+			if got := tt.tls.ServiceAddress("http://touch:8080"); got != tt.address {
+				t.Errorf("ServiceAddress() = %v, expected %v", got, tt.address)
+			}
+		})
+	}
+}
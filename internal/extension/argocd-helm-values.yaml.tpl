@@ -31,6 +31,11 @@ server:
       env:
         - name: EXTENSION_BASE_URL
           value: {{$.ServiceAddress}}
+        {{- with $.PublicKey }}
+        - name: EXTENSION_PUBLIC_KEY
+          value: |
+            {{- . | nindent 12 }}
+        {{- end }}
       volumeMounts:
         - name: tmp
           mountPath: /tmp
@@ -16,6 +16,8 @@ rules:
     verbs:
       - get
       - patch
+      - watch
+      - list
 {{- end }}
 ---
 # Helm Chart Values config
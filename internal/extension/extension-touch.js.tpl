@@ -1,5 +1,93 @@
 ((window) => {
-    const component2 = (context, extensionName) => {
+    const touchAnnotation = 'argocd.bakito.ch/touch';
+    const touchHistoryAnnotation = 'argocd.bakito.ch/touch-history';
+
+    // parseTouchTime returns the timestamp of a touch annotation value in the format "<RFC3339> by: <user>".
+    const parseTouchTime = (value) => {
+        const time = Date.parse((value || '').split(' by: ')[0]);
+        return isNaN(time) ? 0 : time;
+    };
+
+    // errorMessage returns the message of an error response, falling back to the HTTP status.
+    const errorMessage = async (response) => {
+        try {
+            const body = await response.json();
+            if (body?.message) {
+                return body.requestId ? `${body.message} (request ${body.requestId})` : body.message;
+            }
+        } catch (e) {
+            // not an error body of the touch extension, e.g. from the Argo CD proxy
+        }
+        return `${response.status} ${response.statusText}`;
+    };
+
+    // formatTouch formats a touch record of the state endpoint like the touch annotation.
+    const formatTouch = (touch) => touch ? `${touch.time}${touch.user ? ` by: ${touch.user}` : ''}` : '';
+
+    // parseHistory returns the touch records of the history annotation.
+    const parseHistory = (value) => {
+        try {
+            return JSON.parse(value || '[]');
+        } catch (e) {
+            return [];
+        }
+    };
+
+    const statePollInterval = 2000;
+    const statePollCount = 15;
+
+    // progressIcons maps the types of intermediate touch events to icons.
+    const progressIcons = {
+        patched: '✅',
+        watching: '⏳',
+        changed: '🔄',
+    };
+
+    // subscribeEvents reads the server-sent events of a touch request.
+    // EventSource can not be used, as the Argo CD proxy requires additional headers.
+    const subscribeEvents = async (url, headers, signal, onEvent) => {
+        const response = await fetch(url, {
+            method: 'GET',
+            headers: { ...headers, accept: 'text/event-stream' },
+            signal
+        });
+        if (!response.ok || !response.body) {
+            return;
+        }
+        const reader = response.body.getReader();
+        const decoder = new TextDecoder();
+        let buffer = '';
+        for (;;) {
+            const { value, done } = await reader.read();
+            if (done) {
+                return;
+            }
+            buffer += decoder.decode(value, { stream: true });
+            let index = buffer.indexOf('\n\n');
+            while (index >= 0) {
+                const data = buffer.slice(0, index)
+                    .split('\n')
+                    .filter(line => line.startsWith('data: '))
+                    .map(line => line.slice(6))
+                    .join('\n');
+                buffer = buffer.slice(index + 2);
+                if (data) {
+                    onEvent(JSON.parse(data));
+                }
+                index = buffer.indexOf('\n\n');
+            }
+        }
+    };
+
+    // waitMessages maps the wait results of the touch response to status messages.
+    const waitMessages = {
+        Reconciled: '✅ Reconciled',
+        Failed: '❌ Reconcile failed',
+        Timeout: '⏳ Not reconciled yet',
+    };
+
+    const component2 = (context, extensionName, options) => {
+        const { cooldownSeconds, waitFor } = options;
         const app = context.application;
         const appNamespace = app?.metadata?.namespace || '';
         const appName = app?.metadata?.name || '';
@@ -8,27 +96,104 @@
         const resourceNamespace = resource?.metadata?.namespace || '';
         const resourceName = resource?.metadata?.name || '';
         const [statusMessage, setStatusMessage] = React.useState('');
+        const [localTouch, setLocalTouch] = React.useState(0);
+        const [now, setNow] = React.useState(Date.now());
+        const [liveState, setLiveState] = React.useState(null);
+        const pollTimer = React.useRef(null);
+
+        const annotations = resource?.metadata?.annotations || {};
+        const lastTouchValue = liveState ? formatTouch(liveState.lastTouch) : annotations[touchAnnotation];
+        const history = liveState ? (liveState.history || []) : parseHistory(annotations[touchHistoryAnnotation]);
+        const conditions = liveState ? (liveState.conditions || []) : (resource?.status?.conditions || []);
+
+        const lastTouch = Math.max(parseTouchTime(lastTouchValue), localTouch);
+        const remaining = cooldownSeconds > 0 ? Math.ceil((lastTouch + cooldownSeconds * 1000 - now) / 1000) : 0;
+        const coolingDown = remaining > 0;
+
+        React.useEffect(() => {
+            if (!coolingDown) {
+                return undefined;
+            }
+            const timer = setInterval(() => setNow(Date.now()), 1000);
+            return () => clearInterval(timer);
+        }, [coolingDown]);
+
+        React.useEffect(() => () => clearTimeout(pollTimer.current), []);
+
+        const touchURL = `/extensions/touch-${extensionName}/v1/touch/${extensionName}/${resourceNamespace}/${resourceName}`;
+        const headers = {
+            'cache-control': 'no-cache',
+            'Argocd-Application-Name': `${appNamespace}:${appName}`,
+            'Argocd-Project-Name': project,
+        };
+
+        // pollState reads the current state of the object, as the context resource is only updated with the next refresh.
+        const pollState = (count) => {
+            clearTimeout(pollTimer.current);
+            if (count <= 0) {
+                return;
+            }
+            pollTimer.current = setTimeout(async () => {
+                try {
+                    const response = await fetch(touchURL, { method: 'GET', headers });
+                    if (response.ok) {
+                        setLiveState(await response.json());
+                    }
+                } catch (error) {
+                    console.error('Error:', error);
+                }
+                pollState(count - 1);
+            }, statePollInterval);
+        };
 
         const handleClick = async () => {
+            const events = new AbortController();
             try {
-                const response = await fetch(`/extensions/touch-${extensionName}/v1/touch/${extensionName}/${resourceNamespace}/${resourceName}`, {
-                    method: 'PUT',
-                    headers: {
-                        'cache-control': 'no-cache',
-                        'Argocd-Application-Name': `${appNamespace}:${appName}`,
-                        'Argocd-Project-Name': project,
-                    }
-                });
+                if (waitFor) {
+                    clearTimeout(window.touchStatusTimeout);
+                    setStatusMessage('⏳ Waiting for reconcile...');
+                }
+                // the headers are sent before waiting, the body follows once the wait is over
+                const response = await fetch(touchURL, { method: 'PUT', headers });
+                const streamId = response.headers.get('X-Event-Stream-Id');
+                if (waitFor && response.ok && streamId) {
+                    // the final state is taken from the touch response, the stream only shows the progress
+                    subscribeEvents(`${touchURL}/events/${streamId}`, headers, events.signal, (event) => {
+                        if (progressIcons[event.type]) {
+                            clearTimeout(window.touchStatusTimeout);
+                            setStatusMessage(`${progressIcons[event.type]} ${event.message}`);
+                        }
+                    }).catch(() => {
+                        // progress is optional, e.g. if the stream is aborted
+                    });
+                }
+                const body = response.ok ? await response.json().catch(() => ({})) : {};
+                events.abort();
                 clearTimeout(window.touchStatusTimeout);
                 window.touchStatusTimeout = setTimeout(() => setStatusMessage(''), 5000);
-                if (!response.ok) {
-                    setStatusMessage(`❌ Response was not ok: ${response.status} ${response.statusText}`);
-                    throw new Error('Response was not ok');
+                if (response.status === 429) {
+                    setStatusMessage(`⏳ ${await errorMessage(response)}`);
+                } else if (!response.ok) {
+                    const message = await errorMessage(response);
+                    setStatusMessage(`❌ ${message}`);
+                    throw new Error(message);
                 } else {
-                    setStatusMessage('✅ Annotation added!');
+                    setLocalTouch(Date.now());
+                    setNow(Date.now());
+                    if (body.wait) {
+                        const message = waitMessages[body.wait.result] || body.wait.result;
+                        setStatusMessage(body.wait.message ? `${message}: ${body.wait.message}` : message);
+                        clearTimeout(window.touchStatusTimeout);
+                        window.touchStatusTimeout = setTimeout(() => setStatusMessage(''), 15000);
+                    } else {
+                        setStatusMessage('✅ Annotation added!');
+                    }
+                    pollState(statePollCount);
                 }
             } catch (error) {
                 console.error('Error:', error);
+            } finally {
+                events.abort();
             }
         };
 
@@ -57,10 +222,21 @@
                                 React.createElement("div", { className: "row" }, [
                                     React.createElement("div", { className: "columns small-4" }, "Last Touch"),
                                     React.createElement("div", { className: "columns small-4" }, ""),
-                                    React.createElement("div", { className: "columns small-4" }, resource?.metadata?.annotations?.['argocd.bakito.ch/touch'] || 'Never')
+                                    React.createElement("div", { className: "columns small-4" }, lastTouchValue || 'Never')
                                 ])
                             ),
-                            resource?.status?.conditions?.map(condition =>
+                            history.slice(1).map((touch, index) =>
+                                React.createElement(
+                                    "div",
+                                    { className: "argo-table-list__row", key: `history-${index}` },
+                                    React.createElement("div", { className: "row" }, [
+                                        React.createElement("div", { className: "columns small-4" }, index === 0 ? "Previous Touches" : ""),
+                                        React.createElement("div", { className: "columns small-4" }, ""),
+                                        React.createElement("div", { className: "columns small-4" }, formatTouch(touch))
+                                    ])
+                                )
+                            ),
+                            conditions.map(condition =>
                                 React.createElement(
                                     "div",
                                     { className: "argo-table-list__row", key: condition.type },
@@ -76,9 +252,10 @@
                             "button",
                             {
                                 onClick: handleClick,
+                                disabled: coolingDown,
                                 className: "argo-button argo-button--base"
                             },
-                            `Touch ${resource.kind}`
+                            coolingDown ? `Touch ${resource.kind} (${remaining}s)` : `Touch ${resource.kind}`
                         )
                     ),
                     statusMessage && React.createElement(
@@ -95,9 +272,12 @@
         return React.createElement("div", {}, `Hello World ${extensionName}`);
     };
 
-    {{- range $name, $_ := .Resources }}
+    {{- range $name, $res := .Resources }}
     const component_{{$name}} = (context) => {
-        return component2(context, "{{$name}}");
+        return component2(context, "{{$name}}", {
+            cooldownSeconds: {{ $res.Cooldown.Seconds }},
+            waitFor: {{ if $res.WaitFor }}true{{ else }}false{{ end }},
+        });
     };
     {{- end }}
 
@@ -4,17 +4,23 @@ import (
 	"archive/tar"
 	"bytes"
 	"compress/gzip"
+	"crypto/ed25519"
 	"crypto/sha256"
 	_ "embed"
 	"encoding/hex"
 	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"slices"
 	"sort"
+	"strings"
 	"text/template"
 	"time"
 
 	"github.com/bakito/argocd-touch-extension/internal/config"
 	"github.com/bakito/argocd-touch-extension/internal/k8s"
+	"github.com/bakito/argocd-touch-extension/internal/signature"
 	"github.com/bakito/argocd-touch-extension/internal/version"
 	sprig "github.com/go-task/slim-sprig/v3"
 )
@@ -25,9 +31,17 @@ type templateConfig struct {
 }
 
 const (
-	ExtensionJS     = "extension-touch.js"
-	extensionJSPath = "resources/" + ExtensionJS
-	fileMode        = 0o644
+	ExtensionJS       = "extension-touch.js"
+	ExtensionArchive  = "extension.tar.gz"
+	ExtensionChecksum = "extension_checksum.txt"
+
+	// archiveDir is the directory of the extension files in the archive expected by the Argo CD extension installer.
+	archiveDir     = "resources/"
+	templateSuffix = ".tpl"
+	fileMode       = 0o644
+	archiveOwner   = "root"
+	// gzipOSUnknown is the OS header value of RFC 1952 for an unknown OS, to not depend on the build platform.
+	gzipOSUnknown = 255
 )
 
 var (
@@ -58,6 +72,10 @@ type Extension interface {
 	Resources() map[string]config.Resource
 	ExtensionTarGz() ([]byte, string)
 	ExtensionJS() ([]byte, string)
+	// Checksums returns the checksum file of the archive and the script.
+	Checksums() []byte
+	// Signature returns the detached signature of the asset with the given name, if signing is enabled.
+	Signature(name string) ([]byte, bool)
 	ArgoCDConfig() []byte
 	ProxyRBAC() []byte
 }
@@ -69,11 +87,15 @@ type extension struct {
 	extensionJSChecksum  string
 	extensionTar         []byte
 	extensionTarChecksum string
+	checksums            []byte
+	signingKey           ed25519.PrivateKey
+	publicKey            string
+	signatures           map[string][]byte
 	rbac                 []byte
 	resourcesByGroup     map[string][]string
 }
 
-func New(cfg config.TouchConfig, cl k8s.Client, uiExtensionTemplate string) (Extension, error) {
+func New(cfg config.TouchConfig, cl k8s.Resolver, uiExtensionTemplate string) (Extension, error) {
 	resources, err := cl.SetNameAndVersion(cfg.Resources)
 	if err != nil {
 		return nil, &Error{"version resolution", err}
@@ -87,6 +109,15 @@ func New(cfg config.TouchConfig, cl k8s.Client, uiExtensionTemplate string) (Ext
 
 	ext.consolidateResources()
 
+	if cfg.SigningKeyFile != "" {
+		if ext.signingKey, err = signature.LoadPrivateKey(cfg.SigningKeyFile); err != nil {
+			return nil, &Error{"signing", err}
+		}
+		if ext.publicKey, err = signature.PublicKeyPEM(ext.signingKey); err != nil {
+			return nil, &Error{"signing", err}
+		}
+	}
+
 	if err := ext.generateExtensionFiles(uiExtensionTemplate); err != nil {
 		return nil, err
 	}
@@ -100,20 +131,40 @@ func (e *extension) generateExtensionFiles(uiExtensionTemplate string) error {
 	// Generate extension JS and create tar
 
 	uiTpl := templates["extension"]
+	var files []bundleFile
 	if uiExtensionTemplate != "" {
-		data, err := os.ReadFile(uiExtensionTemplate)
+		fi, err := os.Stat(uiExtensionTemplate)
 		if err != nil {
 			return fmt.Errorf("failed to read config file: %w", err)
 		}
-		uiTpl = templateConfig{
-			name:    uiExtensionTemplate,
-			content: string(data),
+		if fi.IsDir() {
+			if files, err = e.renderBundle(uiExtensionTemplate); err != nil {
+				return &Error{"render bundle", err}
+			}
+		} else {
+			data, err := os.ReadFile(uiExtensionTemplate)
+			if err != nil {
+				return fmt.Errorf("failed to read config file: %w", err)
+			}
+			uiTpl = templateConfig{
+				name:    uiExtensionTemplate,
+				content: string(data),
+			}
 		}
 	}
 
-	e.extensionJS, err = e.renderTemplate(uiTpl)
-	if err != nil {
-		return &Error{"render extension", err}
+	if files == nil {
+		e.extensionJS, err = e.renderTemplate(uiTpl)
+		if err != nil {
+			return &Error{"render extension", err}
+		}
+		files = []bundleFile{{name: ExtensionJS, data: e.extensionJS}}
+	} else {
+		i := slices.IndexFunc(files, func(f bundleFile) bool { return f.name == ExtensionJS })
+		if i < 0 {
+			return &Error{"render bundle", fmt.Errorf("bundle %q contains no %s", uiExtensionTemplate, ExtensionJS)}
+		}
+		e.extensionJS = files[i].data
 	}
 
 	e.extensionJSChecksum, err = calculateSHA256(e.extensionJS)
@@ -121,10 +172,15 @@ func (e *extension) generateExtensionFiles(uiExtensionTemplate string) error {
 		return &Error{"checksum extension", err}
 	}
 
-	if e.extensionTar, e.extensionTarChecksum, err = e.createTar(); err != nil {
+	if e.extensionTar, e.extensionTarChecksum, err = createTar(files); err != nil {
 		return &Error{"create tar", err}
 	}
 
+	if e.checksums, err = e.checksumFile(files); err != nil {
+		return &Error{"checksum bundle", err}
+	}
+	e.sign()
+
 	// Generate other template files
 	if e.argocdConfig, err = e.renderTemplate(templates["config"]); err != nil {
 		return &Error{"render config", err}
@@ -149,6 +205,7 @@ func (e *extension) renderTemplate(tpl templateConfig) ([]byte, error) {
 		"Resources":        e.cfg.Resources,
 		"ServiceAddress":   e.cfg.ServiceAddress,
 		"ResourcesByGroup": e.resourcesByGroup,
+		"PublicKey":        e.publicKey,
 	}
 
 	if err := t.Execute(&buf, data); err != nil {
@@ -177,24 +234,128 @@ func (e *extension) ExtensionTarGz() ([]byte, string) {
 	return e.extensionTar, e.extensionTarChecksum
 }
 
-func (e *extension) createTar() (archive []byte, checksum string, err error) {
+func (e *extension) Checksums() []byte {
+	return e.checksums
+}
+
+func (e *extension) Signature(name string) ([]byte, bool) {
+	sig, ok := e.signatures[name]
+	return sig, ok
+}
+
+// sign creates the detached signatures of the assets verified by the installer.
+func (e *extension) sign() {
+	if e.signingKey == nil {
+		return
+	}
+	e.signatures = map[string][]byte{
+		ExtensionJS:       signature.Sign(e.signingKey, e.extensionJS),
+		ExtensionArchive:  signature.Sign(e.signingKey, e.extensionTar),
+		ExtensionChecksum: signature.Sign(e.signingKey, e.checksums),
+	}
+}
+
+// bundleFile is a file of the extension archive, the name is relative to the resources directory.
+type bundleFile struct {
+	name string
+	data []byte
+}
+
+// renderBundle reads the files of the bundle directory, files with the .tpl suffix are rendered and stored without
+// the suffix. Hidden files, like the internal files of a mounted config map, are skipped.
+func (e *extension) renderBundle(dir string) ([]bundleFile, error) {
+	var files []bundleFile
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if n, ok := strings.CutSuffix(name, templateSuffix); ok {
+			if data, err = e.renderTemplate(templateConfig{name: name, content: string(data)}); err != nil {
+				return err
+			}
+			name = n
+		}
+		files = append(files, bundleFile{name: name, data: data})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+	return files, nil
+}
+
+// checksumFile returns the checksums of the archive, the script and the other files of the bundle.
+// The other files are listed with their path in the archive, so they can not collide with the served files.
+func (e *extension) checksumFile(files []bundleFile) ([]byte, error) {
+	lines := []string{
+		e.extensionTarChecksum + "  " + ExtensionArchive,
+		e.extensionJSChecksum + "  " + ExtensionJS,
+	}
+	for _, f := range files {
+		if f.name == ExtensionJS {
+			continue
+		}
+		checksum, err := calculateSHA256(f.data)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, checksum+"  "+archiveDir+f.name)
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// createTar creates the archive for the extension installer. It is byte-for-byte reproducible, so the checksum is
+// the same on all replicas and across restarts: all headers are fixed and the time is taken from the build.
+func createTar(files []bundleFile) (archive []byte, checksum string, err error) {
+	modTime := archiveModTime()
+
 	var buf bytes.Buffer
 	gw := gzip.NewWriter(&buf)
+	gw.ModTime = modTime
+	gw.OS = gzipOSUnknown
 	tw := tar.NewWriter(gw)
 
-	hdr := &tar.Header{
-		Name:    extensionJSPath,
-		Mode:    fileMode,
-		Size:    int64(len(e.extensionJS)),
-		ModTime: time.Now(),
-	}
+	for _, f := range files {
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     archiveDir + f.name,
+			Mode:     fileMode,
+			Size:     int64(len(f.data)),
+			ModTime:  modTime,
+			Uid:      0,
+			Gid:      0,
+			Uname:    archiveOwner,
+			Gname:    archiveOwner,
+			Format:   tar.FormatUSTAR,
+		}
 
-	if err := tw.WriteHeader(hdr); err != nil {
-		return nil, "", err
-	}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, "", err
+		}
 
-	if _, err := tw.Write(e.extensionJS); err != nil {
-		return nil, "", err
+		if _, err := tw.Write(f.data); err != nil {
+			return nil, "", err
+		}
 	}
 
 	if err := tw.Close(); err != nil {
@@ -212,6 +373,14 @@ func (e *extension) createTar() (archive []byte, checksum string, err error) {
 	return archive, checksum, nil
 }
 
+// archiveModTime returns the build time if it was set at build time, otherwise the unix epoch.
+func archiveModTime() time.Time {
+	if t, err := time.Parse(time.RFC3339, version.Build); err == nil {
+		return t.UTC().Truncate(time.Second)
+	}
+	return time.Unix(0, 0).UTC()
+}
+
 func calculateSHA256(data []byte) (string, error) {
 	h := sha256.New()
 	if _, err := h.Write(data); err != nil {
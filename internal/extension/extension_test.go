@@ -1,12 +1,23 @@
 package extension
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"text/template"
+	"time"
 
 	"github.com/bakito/argocd-touch-extension/internal/config"
+	"github.com/bakito/argocd-touch-extension/internal/signature"
+	"github.com/bakito/argocd-touch-extension/internal/version"
 	sprig "github.com/go-task/slim-sprig/v3"
 )
 
@@ -355,3 +366,201 @@ func TestGenerateExtensionFiles(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateTarReproducible(t *testing.T) {
+	tests := []struct {
+		name     string
+		build    string
+		expected time.Time
+	}{
+		{name: "build time", build: "2025-01-02T03:04:05Z", expected: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{name: "no build time", build: "N/A", expected: time.Unix(0, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			build := version.Build
+			version.Build = tt.build
+			defer func() { version.Build = build }()
+
+			files := []bundleFile{{name: ExtensionJS, data: []byte("console.log('touch')")}}
+			first, firstChecksum, err := createTar(files)
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			second, secondChecksum, err := createTar(files)
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if !bytes.Equal(first, second) || firstChecksum != secondChecksum {
+				t.Fatalf("expected identical archives, got checksums %s and %s", firstChecksum, secondChecksum)
+			}
+
+			gr, err := gzip.NewReader(bytes.NewReader(first))
+			if err != nil {
+				t.Fatalf("expected a gzip archive, got: %v", err)
+			}
+			// the timestamps are taken from the build, not from the current time;
+			// a gzip mtime of 0 means no timestamp and is read as zero time
+			if tt.expected.Unix() > 0 && !gr.ModTime.Equal(tt.expected) {
+				t.Errorf("expected gzip mtime %s, got %s", tt.expected, gr.ModTime)
+			}
+			hdr, err := tar.NewReader(gr).Next()
+			if err != nil {
+				t.Fatalf("expected a tar entry, got: %v", err)
+			}
+			if hdr.Name != archiveDir+ExtensionJS || !hdr.ModTime.Equal(tt.expected) ||
+				hdr.Uname != archiveOwner || hdr.Uid != 0 {
+				t.Errorf("unexpected header: %+v", hdr)
+			}
+		})
+	}
+}
+
+func TestSignatures(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	tpls := templates
+	defer func() { templates = tpls }()
+	templates = map[string]templateConfig{
+		"extension": {name: "extensionTpl", content: "Service: {{.ServiceAddress}}"},
+		"config":    {name: "configTpl", content: "{{.PublicKey}}"},
+		"rbac":      {name: "rbacTpl", content: "RBAC"},
+	}
+
+	e := &extension{cfg: config.TouchConfig{ServiceAddress: "svc"}, signingKey: key, publicKey: "public key"}
+	if err := e.generateExtensionFiles(""); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if string(e.ArgoCDConfig()) != "public key" {
+		t.Errorf("expected the public key in the config, got %q", e.ArgoCDConfig())
+	}
+
+	archive, _ := e.ExtensionTarGz()
+	js, _ := e.ExtensionJS()
+	for name, data := range map[string][]byte{
+		ExtensionJS:       js,
+		ExtensionArchive:  archive,
+		ExtensionChecksum: e.Checksums(),
+	} {
+		sig, ok := e.Signature(name)
+		if !ok {
+			t.Fatalf("expected a signature for %s", name)
+		}
+		if err := signature.Verify(pub, data, sig); err != nil {
+			t.Errorf("expected a valid signature for %s, got: %v", name, err)
+		}
+	}
+
+	unsigned := &extension{}
+	if _, ok := unsigned.Signature(ExtensionJS); ok {
+		t.Error("expected no signature without signing key")
+	}
+}
+
+func TestRenderBundle(t *testing.T) {
+	tpls := templates
+	defer func() { templates = tpls }()
+	templates = map[string]templateConfig{
+		"config": {name: "configTpl", content: "config"},
+		"rbac":   {name: "rbacTpl", content: "rbac"},
+	}
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		ExtensionJS + templateSuffix: "Service: {{.ServiceAddress}}",
+		"touch.css":                  "body {}",
+		"i18n/en.json.tpl":           `{"title": "{{ .ServiceAddress }}"}`,
+		"img/icon.png":               "png",
+		".hidden":                    "hidden",
+		"..data/touch.css":           "config map internals",
+	} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	e := &extension{cfg: config.TouchConfig{ServiceAddress: "svc"}}
+	if err := e.generateExtensionFiles(dir); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	js, jsChecksum := e.ExtensionJS()
+	if string(js) != "Service: svc" {
+		t.Errorf("expected rendered script, got %q", js)
+	}
+
+	archive, archiveChecksum := e.ExtensionTarGz()
+	gr, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatalf("expected a gzip archive, got: %v", err)
+	}
+	tr := tar.NewReader(gr)
+	content := make(map[string]string)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		data, _ := io.ReadAll(tr)
+		names = append(names, hdr.Name)
+		content[hdr.Name] = string(data)
+	}
+	expected := []string{"resources/extension-touch.js", "resources/i18n/en.json", "resources/img/icon.png",
+		"resources/touch.css"}
+	if !slices.Equal(names, expected) {
+		t.Fatalf("expected archive entries %v, got %v", expected, names)
+	}
+	if content["resources/i18n/en.json"] != `{"title": "svc"}` {
+		t.Errorf("expected rendered json, got %q", content["resources/i18n/en.json"])
+	}
+
+	cssChecksum, _ := calculateSHA256([]byte("body {}"))
+	lines := strings.Split(string(e.Checksums()), "\n")
+	if len(lines) != 5 ||
+		lines[0] != archiveChecksum+"  "+ExtensionArchive ||
+		lines[1] != jsChecksum+"  "+ExtensionJS ||
+		lines[4] != cssChecksum+"  resources/touch.css" {
+		t.Errorf("unexpected checksums: %v", lines)
+	}
+}
+
+func TestChecksumFileBundleNames(t *testing.T) {
+	e := &extension{extensionTarChecksum: "tar", extensionJSChecksum: "js"}
+	checksums, err := e.checksumFile([]bundleFile{
+		{name: ExtensionArchive, data: []byte("not the archive")},
+		{name: ExtensionJS, data: []byte("js")},
+		{name: "sub/" + ExtensionJS, data: []byte("other js")},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	var names []string
+	for line := range strings.SplitSeq(string(checksums), "\n") {
+		names = append(names, strings.Fields(line)[1])
+	}
+	expected := []string{ExtensionArchive, ExtensionJS, "resources/" + ExtensionArchive, "resources/sub/" + ExtensionJS}
+	if !slices.Equal(names, expected) {
+		t.Errorf("expected checksum names %v, got %v", expected, names)
+	}
+}
+
+func TestRenderBundleWithoutScript(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "touch.css"), []byte("body {}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	e := &extension{}
+	if err := e.generateExtensionFiles(dir); err == nil {
+		t.Fatal("expected an error for a bundle without script")
+	}
+}
@@ -0,0 +1,160 @@
+package install
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+var (
+	// maxArchiveSize is the max total size of the extracted files.
+	maxArchiveSize int64 = 64 << 20
+	// maxArchiveFiles is the max number of entries of the archive.
+	maxArchiveFiles = 1000
+)
+
+// installArchive extracts the archive into a scratch directory and exchanges it with the installed extension directory.
+// Argo CD loads all extension scripts below the installation directory, so the scratch directory and the backup of the
+// previous version are kept next to it: neither a partially extracted nor the previous extension is visible to Argo CD.
+func installArchive(archive []byte) error {
+	dir := installDir()
+	root := filepath.Dir(dir)
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return err
+	}
+	if err := removeLeftovers(dir); err != nil {
+		return err
+	}
+
+	// the scratch directory has to be on the file system of the installation directory to be renamed
+	scratch, err := os.MkdirTemp(filepath.Dir(root), ".extension-"+filepath.Base(dir)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(scratch)
+	tmp := filepath.Join(scratch, filepath.Base(dir))
+	if err := os.Mkdir(tmp, 0o755); err != nil {
+		return err
+	}
+
+	slog.Info("Extracting extension archive", "dir", tmp)
+	if err := extract(archive, tmp); err != nil {
+		return fmt.Errorf("extract archive: %w", err)
+	}
+
+	slog.Info("Installing extension to", "path", dir)
+	if err := exchangeDir(tmp, dir); err != nil {
+		return fmt.Errorf("install extension: %w", err)
+	}
+
+	// the previous version is kept until the next installation, so Argo CD can finish reading it
+	backup := filepath.Join(filepath.Dir(root), ".extension-"+filepath.Base(dir)+backupSuffix)
+	if err := os.RemoveAll(backup); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, backup); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// removeLeftovers removes the backup and temporary directories of interrupted installations of previous versions,
+// which were created in the installation directory.
+func removeLeftovers(dir string) error {
+	leftovers, err := filepath.Glob(filepath.Join(filepath.Dir(dir), "."+filepath.Base(dir)+"-*"))
+	if err != nil {
+		return err
+	}
+	for _, l := range append(leftovers, dir+".old") {
+		if err := os.RemoveAll(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extract writes the regular files and directories of the gzipped tar archive into dir.
+// Entries escaping dir, links and archives exceeding the size limits are rejected.
+func extract(archive []byte, dir string) error {
+	gr, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	var size int64
+	for files := 0; ; files++ {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if files >= maxArchiveFiles {
+			return fmt.Errorf("archive contains more than %d entries", maxArchiveFiles)
+		}
+		if !filepath.IsLocal(hdr.Name) {
+			return fmt.Errorf("archive entry %q is outside of the extension directory", hdr.Name)
+		}
+		target := filepath.Join(dir, hdr.Name)
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			size += hdr.Size
+			if size > maxArchiveSize {
+				return fmt.Errorf("archive exceeds the max size of %d bytes", maxArchiveSize)
+			}
+			if err := writeEntry(tr, target, hdr.Size); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("archive entry %q has unsupported type %q", hdr.Name, hdr.Typeflag)
+		}
+	}
+}
+
+// writeEntry writes exactly size bytes of the reader to the target file.
+func writeEntry(r io.Reader, target string, size int64) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.CopyN(f, r, size); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// replaceDir moves dir next to the new directory and renames the new directory to dir, the previous version ends up at
+// the path of the new directory like with exchangeDir. It is not atomic, dir is missing in between, but the previous
+// version is never left in the installation directory. The previous directory is restored if the new one can't be
+// moved.
+func replaceDir(newDir, dir string) error {
+	old := newDir + ".old"
+	if err := os.Rename(dir, old); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return os.Rename(newDir, dir)
+	}
+	if err := os.Rename(newDir, dir); err != nil {
+		return errors.Join(err, os.Rename(old, dir))
+	}
+	return os.Rename(old, newDir)
+}
@@ -0,0 +1,256 @@
+package install
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// argoCDExtensionPattern matches the scripts Argo CD loads from the extension directory.
+var argoCDExtensionPattern = regexp.MustCompile(`^extension(.*)\.js$`)
+
+type entry struct {
+	name     string
+	typeflag byte
+	content  string
+	linkname string
+}
+
+func tarGz(t *testing.T, entries ...entry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, e := range entries {
+		if e.typeflag == 0 {
+			e.typeflag = tar.TypeReg
+		}
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name:     e.name,
+			Typeflag: e.typeflag,
+			Linkname: e.linkname,
+			Mode:     0o644,
+			Size:     int64(len(e.content)),
+		}))
+		_, err := tw.Write([]byte(e.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+	return buf.Bytes()
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name      string
+		entries   []entry
+		expectErr string
+	}{
+		{
+			name: "bundle",
+			entries: []entry{
+				{name: "resources/", typeflag: tar.TypeDir},
+				{name: "resources/extension-touch.js", content: "js"},
+				{name: "resources/i18n/en.json", content: "{}"},
+			},
+		},
+		{name: "parent", entries: []entry{{name: "../evil.js", content: "js"}}, expectErr: "outside"},
+		{name: "nested parent", entries: []entry{{name: "resources/../../evil.js"}}, expectErr: "outside"},
+		{name: "absolute", entries: []entry{{name: "/etc/evil.js"}}, expectErr: "outside"},
+		{
+			name:      "symlink",
+			entries:   []entry{{name: "resources/link", typeflag: tar.TypeSymlink, linkname: "/etc/passwd"}},
+			expectErr: "unsupported type",
+		},
+		{
+			name:      "hardlink",
+			entries:   []entry{{name: "resources/link", typeflag: tar.TypeLink, linkname: "/etc/passwd"}},
+			expectErr: "unsupported type",
+		},
+		{
+			name:      "duplicate",
+			entries:   []entry{{name: "resources/a.js", content: "a"}, {name: "resources/a.js", content: "b"}},
+			expectErr: "exists",
+		},
+		{
+			name:      "too large",
+			entries:   []entry{{name: "resources/a.js", content: "12345"}, {name: "resources/b.js", content: "12345678"}},
+			expectErr: "max size",
+		},
+	}
+	maxSize := maxArchiveSize
+	maxArchiveSize = 10
+	defer func() { maxArchiveSize = maxSize }()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			err := extract(tarGz(t, tt.entries...), dir)
+			if tt.expectErr != "" {
+				require.ErrorContains(t, err, tt.expectErr)
+				assert.NoFileExists(t, filepath.Join(filepath.Dir(dir), "evil.js"))
+				return
+			}
+			require.NoError(t, err)
+			for _, e := range tt.entries {
+				if e.typeflag == tar.TypeDir {
+					assert.DirExists(t, filepath.Join(dir, e.name))
+					continue
+				}
+				data, err := os.ReadFile(filepath.Join(dir, e.name))
+				require.NoError(t, err)
+				assert.Equal(t, e.content, string(data))
+			}
+		})
+	}
+}
+
+func TestExtractTooManyFiles(t *testing.T) {
+	maxFiles := maxArchiveFiles
+	maxArchiveFiles = 1
+	defer func() { maxArchiveFiles = maxFiles }()
+
+	err := extract(tarGz(t, entry{name: "a.js"}, entry{name: "b.js"}), t.TempDir())
+	require.ErrorContains(t, err, "more than 1 entries")
+}
+
+func TestInstallArchive(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "extensions")
+	t.Setenv(envExtensionInstallationDir, dir)
+	touchDir := filepath.Join(dir, "touch")
+	require.NoError(t, os.MkdirAll(touchDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(touchDir, "stale.js"), []byte("stale"), 0o644))
+
+	require.NoError(t, installArchive(tarGz(t, entry{name: "resources/extension-touch.js", content: "js"})))
+
+	assert.FileExists(t, filepath.Join(touchDir, "resources", "extension-touch.js"))
+	assert.NoFileExists(t, filepath.Join(touchDir, "stale.js"))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "temporary and backup directories are removed")
+
+	// a broken archive keeps the installed extension
+	require.Error(t, installArchive(tarGz(t, entry{name: "../evil.js"})))
+	assert.FileExists(t, filepath.Join(touchDir, "resources", "extension-touch.js"))
+	entries, err = os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+	entries, err = os.ReadDir(parent)
+	require.NoError(t, err)
+	require.Len(t, entries, 2, "scratch directories are removed")
+	assert.Equal(t, ".extension-touch.bak", entries[0].Name())
+	assert.Equal(t, "extensions", entries[1].Name())
+}
+
+func TestInstallArchiveBackup(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "extensions")
+	t.Setenv(envExtensionInstallationDir, dir)
+
+	require.NoError(t, installArchive(tarGz(t, entry{name: "resources/extension-touch.js", content: "v1"})))
+	require.NoError(t, installArchive(tarGz(t, entry{name: "resources/extension-touch.js", content: "v2"})))
+
+	data, err := os.ReadFile(filepath.Join(dir, "touch", "resources", "extension-touch.js"))
+	require.NoError(t, err)
+	assert.Equal(t, "v2", string(data))
+	data, err = os.ReadFile(filepath.Join(parent, ".extension-touch.bak", "resources", "extension-touch.js"))
+	require.NoError(t, err)
+	assert.Equal(t, "v1", string(data), "the previous version is kept outside of the installation directory")
+}
+
+func TestReplaceDir(t *testing.T) {
+	parent := t.TempDir()
+	newDir, dir := filepath.Join(parent, "new"), filepath.Join(parent, "dir")
+	require.NoError(t, os.MkdirAll(newDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(newDir, "v"), []byte("new"), 0o644))
+
+	require.NoError(t, replaceDir(newDir, dir))
+	assert.FileExists(t, filepath.Join(dir, "v"))
+	assert.NoDirExists(t, newDir)
+
+	require.NoError(t, os.MkdirAll(newDir, 0o755))
+	require.NoError(t, replaceDir(newDir, dir))
+	assert.NoFileExists(t, filepath.Join(dir, "v"))
+	assert.FileExists(t, filepath.Join(newDir, "v"), "the previous version is moved to the new directory")
+}
+
+func TestInstallArchiveRemovesLeftovers(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "extensions")
+	t.Setenv(envExtensionInstallationDir, dir)
+	for _, leftover := range []string{"touch.old", ".touch-123"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, leftover, "resources"), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, leftover, "resources", "extension-touch.js"), nil, 0o644))
+	}
+
+	require.NoError(t, installArchive(tarGz(t, entry{name: "resources/extension-touch.js", content: "js"})))
+
+	assert.Equal(t, []string{filepath.Join(dir, "touch", "resources", "extension-touch.js")}, extensionScripts(t, dir))
+}
+
+// TestInstallArchiveSwap checks, while the extension is installed again and again, that Argo CD never finds a script
+// outside of the installed extension directory, like a partially extracted or a previous one.
+func TestInstallArchiveSwap(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "extensions")
+	t.Setenv(envExtensionInstallationDir, dir)
+	archive := tarGz(t,
+		entry{name: "resources/", typeflag: tar.TypeDir},
+		entry{name: "resources/extension-touch.js", content: strings.Repeat("js", 1<<16)},
+		entry{name: "resources/i18n/en.json", content: "{}"},
+	)
+	require.NoError(t, installArchive(archive))
+	expected := []string{filepath.Join(dir, "touch", "resources", "extension-touch.js")}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				assert.DirExists(t, filepath.Join(dir, "touch"), "the installed extension is never missing")
+				// a walk may miss the script of a directory replaced while it was read, but never finds another one
+				scripts := extensionScripts(t, dir)
+				assert.LessOrEqual(t, len(scripts), 1)
+				assert.Subset(t, expected, scripts)
+			}
+		}
+	})
+	for range 20 {
+		require.NoError(t, installArchive(archive))
+	}
+	close(done)
+	wg.Wait()
+}
+
+// extensionScripts returns the scripts Argo CD loads from the installation directory.
+func extensionScripts(t *testing.T, dir string) []string {
+	t.Helper()
+	var scripts []string
+	assert.NoError(t, filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			// a directory replaced while it was read
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() && argoCDExtensionPattern.MatchString(info.Name()) {
+			scripts = append(scripts, path)
+		}
+		return nil
+	}))
+	return scripts
+}
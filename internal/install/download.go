@@ -0,0 +1,194 @@
+package install
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"time"
+)
+
+var (
+	httpTimeout = 30 * time.Second
+	// maxBackoff caps the exponential backoff between two attempts.
+	maxBackoff = 30 * time.Second
+)
+
+const defaultBackoff = time.Second
+
+// statusError is returned for unexpected HTTP status codes.
+type statusError struct {
+	url  string
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status %d from %s", e.code, e.url)
+}
+
+// downloader fetches the extension assets and retries transient failures with exponential backoff
+// until the context is done.
+type downloader struct {
+	client    *http.Client
+	backoff   time.Duration
+	token     string
+	tokenFile string
+}
+
+func newDownloader(opts Options) (*downloader, error) {
+	client, err := newHTTPClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	d := &downloader{
+		client:    client,
+		backoff:   opts.Backoff,
+		token:     cmp.Or(opts.Token, os.Getenv(envExtensionToken)),
+		tokenFile: cmp.Or(opts.TokenFile, os.Getenv(envExtensionTokenFile)),
+	}
+	if d.backoff <= 0 {
+		d.backoff = defaultBackoff
+	}
+	return d, nil
+}
+
+// readAll downloads the content at the given URL and returns the body as bytes.
+// Connection errors, server errors and throttling are retried, other client errors fail immediately.
+func (d *downloader) readAll(ctx context.Context, u string) ([]byte, error) {
+	var b []byte
+	err := d.retry(ctx, u, isTransient, func() (err error) {
+		b, err = d.readOnce(ctx, u)
+		return err
+	})
+	return b, err
+}
+
+// waitReady polls the URL until it returns a success status. Any status is retried, as a proxy in front of the
+// server may respond with a client error until the server is available, other errors only if they are transient.
+func (d *downloader) waitReady(ctx context.Context, u string) error {
+	slog.Info("Waiting for server", "url", u)
+	retryable := func(err error) bool {
+		var se *statusError
+		return errors.As(err, &se) || isTransient(err)
+	}
+	err := d.retry(ctx, u, retryable, func() error {
+		_, err := d.readOnce(ctx, u)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	slog.Info("Server is ready", "url", u)
+	return nil
+}
+
+// retry calls fn until it succeeds, returns a non retryable error or the context is done.
+func (d *downloader) retry(ctx context.Context, u string, retryable func(error) bool, fn func() error) error {
+	delay := d.backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil || !retryable(err) {
+			return err
+		}
+		slog.Warn("Request failed, retrying", "url", u, "attempt", attempt, "retryIn", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxBackoff)
+	}
+}
+
+func (d *downloader) readOnce(ctx context.Context, u string) ([]byte, error) {
+	b, _, err := d.readIfNoneMatch(ctx, u, "")
+	return b, err
+}
+
+// readIfNoneMatch downloads the content at the given URL once and returns it with the ETag of the response.
+// If the given ETag is not empty and still matches, the server responds with 304 Not Modified and the content is nil.
+func (d *downloader) readIfNoneMatch(ctx context.Context, u, etag string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, http.NoBody)
+	if err != nil {
+		return nil, "", err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	token, err := d.bearerToken()
+	if err != nil {
+		return nil, "", err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if etag != "" && resp.StatusCode == http.StatusNotModified {
+		return nil, etag, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, "", &statusError{url: u, code: resp.StatusCode}
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	return b, resp.Header.Get("ETag"), nil
+}
+
+// isTransient returns true for errors that may succeed on retry: connection errors, timeouts, server errors and
+// throttling. Other client errors like 404, TLS verification failures and local configuration errors like a missing
+// token file or an invalid URL are permanent.
+func isTransient(err error) bool {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code >= http.StatusInternalServerError ||
+			se.code == http.StatusTooManyRequests ||
+			se.code == http.StatusRequestTimeout
+	}
+	if errors.Is(err, context.Canceled) || isTLSError(err) {
+		return false
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	// url.Error implements net.Error for any error of the request, only the cause tells if it was a network error
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// isTLSError returns true if the server certificate could not be verified or the server rejected the client
+// certificate, both do not change without reconfiguration.
+func isTLSError(err error) bool {
+	var verifyErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	var alert tls.AlertError
+	return errors.As(err, &verifyErr) ||
+		errors.As(err, &unknownAuthority) ||
+		errors.As(err, &hostnameErr) ||
+		errors.As(err, &invalidErr) ||
+		errors.As(err, &alert)
+}
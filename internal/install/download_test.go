@@ -0,0 +1,143 @@
+package install
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyServer responds with the given status codes, then with 200 and the body.
+func flakyServer(t *testing.T, codes ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		n := int(requests.Add(1))
+		if n <= len(codes) {
+			w.WriteHeader(codes[n-1])
+			return
+		}
+		_, _ = w.Write([]byte("body"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestReadAll(t *testing.T) {
+	tests := []struct {
+		name      string
+		codes     []int
+		requests  int32
+		expectErr bool
+	}{
+		{name: "success", requests: 1},
+		{name: "server errors", codes: []int{http.StatusServiceUnavailable, http.StatusBadGateway}, requests: 3},
+		{name: "throttled", codes: []int{http.StatusTooManyRequests}, requests: 2},
+		{name: "not found", codes: []int{http.StatusNotFound}, requests: 1, expectErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, requests := flakyServer(t, tt.codes...)
+			d, err := newDownloader(Options{Backoff: time.Millisecond})
+			require.NoError(t, err)
+
+			b, err := d.readAll(t.Context(), srv.URL)
+
+			if tt.expectErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, "body", string(b))
+			}
+			assert.Equal(t, tt.requests, requests.Load())
+		})
+	}
+}
+
+func TestReadAllDeadline(t *testing.T) {
+	codes := make([]int, 100)
+	for i := range codes {
+		codes[i] = http.StatusServiceUnavailable
+	}
+	srv, requests := flakyServer(t, codes...)
+	d, err := newDownloader(Options{Backoff: 10 * time.Millisecond})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	_, err = d.readAll(ctx, srv.URL)
+
+	require.ErrorContains(t, err, "giving up after")
+	assert.Less(t, requests.Load(), int32(10))
+}
+
+func TestWaitReady(t *testing.T) {
+	srv, requests := flakyServer(t, http.StatusNotFound, http.StatusServiceUnavailable)
+	d, err := newDownloader(Options{Backoff: time.Millisecond})
+	require.NoError(t, err)
+
+	require.NoError(t, d.waitReady(t.Context(), srv.URL))
+	assert.Equal(t, int32(3), requests.Load())
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{name: "server error", err: &statusError{code: http.StatusBadGateway}, transient: true},
+		{name: "not found", err: &statusError{code: http.StatusNotFound}},
+		{
+			name:      "connection refused",
+			err:       &url.Error{Op: "Get", Err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}},
+			transient: true,
+		},
+		{name: "connection reset", err: &url.Error{Op: "Get", Err: syscall.ECONNRESET}, transient: true},
+		{name: "unexpected eof", err: &url.Error{Op: "Get", Err: io.EOF}, transient: true},
+		{name: "dns", err: &url.Error{Op: "Get", Err: &net.DNSError{Err: "no such host"}}, transient: true},
+		{name: "unknown authority", err: &url.Error{Op: "Get", Err: &tls.CertificateVerificationError{
+			Err: x509.UnknownAuthorityError{},
+		}}},
+		{name: "missing token file", err: fmt.Errorf("read token: %w", os.ErrNotExist)},
+		{name: "invalid url", err: &url.Error{Op: "Get", Err: errors.New("unsupported protocol scheme")}},
+		{name: "canceled", err: &url.Error{Op: "Get", Err: context.Canceled}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.transient, isTransient(tt.err))
+		})
+	}
+}
+
+func TestReadAllUntrustedServer(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		requests.Add(1)
+	}))
+	t.Cleanup(srv.Close)
+	d, err := newDownloader(Options{Backoff: time.Millisecond})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	_, err = d.readAll(ctx, srv.URL)
+
+	require.Error(t, err)
+	require.NotErrorIs(t, ctx.Err(), context.DeadlineExceeded, "tls verification errors are not retried")
+	assert.Zero(t, requests.Load())
+}
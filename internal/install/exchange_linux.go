@@ -0,0 +1,24 @@
+//go:build linux
+
+package install
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// exchangeDir atomically exchanges the new directory with dir, the previous version ends up at the path of the new
+// directory. If dir does not exist yet, the new directory is renamed. File systems without support for the exchange
+// fall back to replaceDir.
+func exchangeDir(newDir, dir string) error {
+	err := unix.Renameat2(unix.AT_FDCWD, newDir, unix.AT_FDCWD, dir, unix.RENAME_EXCHANGE)
+	switch {
+	case errors.Is(err, unix.ENOENT):
+		return os.Rename(newDir, dir)
+	case errors.Is(err, unix.EINVAL), errors.Is(err, unix.ENOSYS):
+		return replaceDir(newDir, dir)
+	}
+	return err
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package install
+
+// exchangeDir replaces dir with the new directory, an atomic exchange is only supported on linux.
+func exchangeDir(newDir, dir string) error {
+	return replaceDir(newDir, dir)
+}
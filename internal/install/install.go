@@ -1,77 +1,271 @@
 package install
 
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"io"
 	"log/slog"
-	"net/http"
-	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/bakito/argocd-touch-extension/internal/extension"
 	"github.com/bakito/argocd-touch-extension/internal/server"
+	"github.com/bakito/argocd-touch-extension/internal/signature"
 )
 
 const (
 	envExtensionBaseURL         = "EXTENSION_BASE_URL"
 	envExtensionInstallationDir = "EXTENSION_INSTALLATION_DIR"
+	envExtensionPublicKey       = "EXTENSION_PUBLIC_KEY"
+	envExtensionReadyURL        = "EXTENSION_READY_URL"
+	envExtensionCAFile          = "EXTENSION_CA_FILE"
+	envExtensionClientCertFile  = "EXTENSION_CLIENT_CERT_FILE"
+	envExtensionClientKeyFile   = "EXTENSION_CLIENT_KEY_FILE"
+	envExtensionToken           = "EXTENSION_TOKEN"
+	envExtensionTokenFile       = "EXTENSION_TOKEN_FILE"
+	envExtensionProxy           = "EXTENSION_PROXY"
 
 	defaultInstallationDir = "/tmp/extensions/"
+	// backupSuffix is appended to the previous version of the script, Argo CD ignores files not ending with .js.
+	backupSuffix = ".bak"
+
+	defaultInterval = 30 * time.Second
 )
 
-var httpTimeout = 30 * time.Second
+// Options of the installation.
+type Options struct {
+	// PublicKey is the pinned ed25519 public key, PEM or base64 encoded, the downloaded assets must be signed with.
+	// Defaults to the EXTENSION_PUBLIC_KEY environment variable, signatures are not verified if both are empty.
+	PublicKey string
+	// Archive installs all files of extension.tar.gz instead of the script only.
+	Archive bool
+	// Timeout is the total deadline of the installation including retries, 0 disables the deadline.
+	Timeout time.Duration
+	// Backoff is the delay before the first retry of a failed download, it doubles with each further retry.
+	Backoff time.Duration
+	// ReadyURL is polled until it returns a success status before downloading, e.g. the readiness endpoint of the
+	// server. Defaults to the EXTENSION_READY_URL environment variable, no wait if both are empty.
+	ReadyURL string
+	// Interval is the delay between two checks for changes of the extension in watch mode.
+	Interval time.Duration
+	// File installs a local script or archive (.tar.gz or .tgz) instead of downloading it. The checksums and
+	// signatures are read from the directory of the file.
+	File string
+	// Extension installs the locally rendered extension instead of downloading it.
+	Extension extension.Extension
+	// CAFile is a PEM bundle of CAs trusted in addition to the system roots for downloads.
+	// Defaults to the EXTENSION_CA_FILE environment variable.
+	CAFile string
+	// ClientCertFile and ClientKeyFile are the PEM encoded client certificate and key presented to the server.
+	// They default to the EXTENSION_CLIENT_CERT_FILE and EXTENSION_CLIENT_KEY_FILE environment variables.
+	ClientCertFile string
+	ClientKeyFile  string
+	// Token is sent as bearer token with each download, defaults to the EXTENSION_TOKEN environment variable.
+	Token string
+	// TokenFile contains the bearer token and is read with each download, it takes precedence over the token.
+	// Defaults to the EXTENSION_TOKEN_FILE environment variable.
+	TokenFile string
+	// Proxy is the URL of the proxy used for downloads, defaults to the EXTENSION_PROXY environment variable.
+	// If both are empty, the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables apply.
+	Proxy string
+}
 
-func Do(ctx context.Context) error {
-	baseURL, ok := os.LookupEnv(envExtensionBaseURL)
-	if !ok {
-		return fmt.Errorf("missing environment variable: '%s'", envExtensionBaseURL)
+func Do(ctx context.Context, opts Options) error {
+	i, err := newInstaller(opts)
+	if err != nil {
+		return err
+	}
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	if i.remote != nil {
+		if err := i.remote.waitReady(ctx); err != nil {
+			return err
+		}
+	}
+	checksumBytes, err := i.src.read(ctx, server.ExtensionChecksum)
+	if err != nil {
+		return fmt.Errorf("%s checksum: %w", i.verb, err)
 	}
-	// Download extension file
-	extURL, err := url.JoinPath(baseURL, server.APIPathV1, server.APIPathExtension, extension.ExtensionJS)
+	return i.install(ctx, checksumBytes)
+}
+
+// Watch installs the extension and keeps it in sync with the touch service until the context is done.
+// The checksum file is polled with the ETag of the last response and the extension is installed again when it
+// changes. Failures are logged and retried with the next poll, so the sidecar survives restarts of the service.
+func Watch(ctx context.Context, opts Options) error {
+	i, err := newInstaller(opts)
 	if err != nil {
-		return fmt.Errorf("build extension URL: %w", err)
+		return err
+	}
+	if i.remote == nil {
+		return errors.New("watch mode requires downloading the extension from the service")
+	}
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	if err := i.remote.waitReady(ctx); err != nil {
+		return err
+	}
+	slog.Info("Watching extension for changes", "url", i.remote.checksumURL, "interval", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var etag string
+	var installed []byte
+	for {
+		etag, installed = i.sync(ctx, opts.Timeout, etag, installed)
+		select {
+		case <-ctx.Done():
+			slog.Info("Stopped watching extension")
+			return nil
+		case <-ticker.C:
+		}
 	}
-	slog.Info("Downloading extension from", "url", extURL)
-	extensionBytes, err := readAllFromURL(ctx, extURL)
+}
+
+// installer verifies and installs the extension provided by its source.
+type installer struct {
+	src source
+	// remote is the source if the extension is downloaded from the touch service.
+	remote    *remote
+	verb      string
+	publicKey ed25519.PublicKey
+	name      string
+	archive   bool
+}
+
+func newInstaller(opts Options) (*installer, error) {
+	publicKey, err := opts.publicKey()
 	if err != nil {
-		return fmt.Errorf("download extension: %w", err)
+		return nil, err
+	}
+	i := &installer{
+		publicKey: publicKey,
+		name:      extension.ExtensionJS,
+		archive: opts.Archive ||
+			strings.HasSuffix(opts.File, ".tar.gz") || strings.HasSuffix(opts.File, ".tgz"),
+	}
+	if i.archive {
+		i.name = extension.ExtensionArchive
+	}
+	switch {
+	case opts.File != "":
+		i.src, i.verb = &fileSource{file: opts.File, name: i.name}, "read"
+	case opts.Extension != nil:
+		i.src, i.verb = &renderedSource{ext: opts.Extension}, "render"
+	default:
+		if i.remote, err = newRemote(opts); err != nil {
+			return nil, err
+		}
+		i.src, i.verb = i.remote, "download"
+	}
+	return i, nil
+}
+
+// sync installs the extension if the checksums changed since the last poll and returns the ETag and the checksums
+// of the installed version. On failure, the ETag is reset to download the checksums again with the next poll.
+func (i *installer) sync(ctx context.Context, timeout time.Duration, etag string, installed []byte) (string, []byte) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
-	// Download checksum file
-	checksumURL, err := url.JoinPath(baseURL, server.APIPathV1, server.APIPathExtension, server.ExtensionChecksum)
+	checksumBytes, newETag, err := i.remote.d.readIfNoneMatch(ctx, i.remote.checksumURL, etag)
 	if err != nil {
-		return fmt.Errorf("build checksum URL: %w", err)
+		slog.Error("Failed to check extension for changes", "url", i.remote.checksumURL, "error", err)
+		return "", installed
+	}
+	if checksumBytes == nil || bytes.Equal(checksumBytes, installed) {
+		return newETag, installed
 	}
-	slog.Info("Downloading checksum from", "url", checksumURL)
-	checksumBytes, err := readAllFromURL(ctx, checksumURL)
+	slog.Info("Extension changed", "url", i.remote.checksumURL)
+	if err := i.install(ctx, checksumBytes); err != nil {
+		slog.Error("Extension installation failed, retrying with the next poll", "error", err)
+		return "", installed
+	}
+	return newETag, checksumBytes
+}
+
+// install reads the extension from the source and installs it after verifying it against the given checksums.
+func (i *installer) install(ctx context.Context, checksumBytes []byte) error {
+	extensionBytes, err := i.src.read(ctx, i.name)
 	if err != nil {
-		return fmt.Errorf("download checksum: %w", err)
+		return fmt.Errorf("%s extension: %w", i.verb, err)
+	}
+	if i.publicKey != nil {
+		if err := i.verifySignature(ctx, server.ExtensionChecksum, checksumBytes); err != nil {
+			return err
+		}
+		if err := i.verifySignature(ctx, i.name, extensionBytes); err != nil {
+			return err
+		}
 	}
 	// Calculate SHA256 of extension
-	slog.Info("Calculating checksum for", "file", extension.ExtensionJS)
+	slog.Info("Calculating checksum for", "file", i.name)
 	actualChecksum := checksumHex(extensionBytes)
 	// Compare checksums
-	expectedChecksum, found := extractChecksumFor(string(checksumBytes), extension.ExtensionJS)
+	expectedChecksum, found := extractChecksumFor(string(checksumBytes), i.name)
 	if !found {
-		return fmt.Errorf("no checksum found for %s", extension.ExtensionJS)
+		return fmt.Errorf("no checksum found for %s", i.name)
 	}
 	if actualChecksum != expectedChecksum {
 		return fmt.Errorf("checksum mismatch. Expected: %s, got: %s", expectedChecksum, actualChecksum)
 	}
 	slog.Info("Checksum OK", "sum", actualChecksum)
-	if err := install(extensionBytes); err != nil {
+	if i.archive {
+		err = installArchive(extensionBytes)
+	} else {
+		err = install(extensionBytes)
+	}
+	if err != nil {
 		return err
 	}
 	slog.Info("Extension successfully installed")
 	return nil
 }
 
-func install(extensionBytes []byte) error {
+// verifySignature reads the detached signature of the named asset and verifies the data with it.
+func (i *installer) verifySignature(ctx context.Context, name string, data []byte) error {
+	sig, err := i.src.read(ctx, name+signature.Suffix)
+	if err != nil {
+		return fmt.Errorf("%s signature: %w", i.verb, err)
+	}
+	if err := signature.Verify(i.publicKey, data, sig); err != nil {
+		return fmt.Errorf("verify %s: %w", name, err)
+	}
+	slog.Info("Signature OK", "file", name)
+	return nil
+}
+
+// publicKey returns the pinned public key, or nil if none is configured.
+func (o Options) publicKey() (ed25519.PublicKey, error) {
+	key := o.PublicKey
+	if key == "" {
+		key = os.Getenv(envExtensionPublicKey)
+	}
+	if key == "" {
+		return nil, nil
+	}
+	pub, err := signature.ParsePublicKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	return pub, nil
+}
+
+// installDir returns the directory of the touch extension.
+func installDir() string {
 	dir := defaultInstallationDir
 	if val, ok := os.LookupEnv(envExtensionInstallationDir); ok {
 		dir = val
@@ -79,6 +273,11 @@ func install(extensionBytes []byte) error {
 	if !strings.HasSuffix(dir, "/touch") {
 		dir = filepath.Join(dir, "touch")
 	}
+	return dir
+}
+
+func install(extensionBytes []byte) error {
+	dir := installDir()
 
 	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
 		slog.Info("Create extension dir", "dir", dir)
@@ -90,29 +289,90 @@ func install(extensionBytes []byte) error {
 	extPath := filepath.Join(dir, extension.ExtensionJS)
 
 	slog.Info("Installing extension to", "path", extPath)
-	return os.WriteFile(extPath, extensionBytes, 0o644)
+	if err := writeAtomic(extPath, extensionBytes); err != nil {
+		return err
+	}
+	return removeStale(dir, extension.ExtensionJS, extension.ExtensionJS+backupSuffix)
 }
 
-// readAllFromURL downloads the content at the given URL and returns the body as bytes.
-func readAllFromURL(ctx context.Context, u string) ([]byte, error) {
-	client := &http.Client{Timeout: httpTimeout}
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, http.NoBody)
+// removeStale removes all entries of the directory except the given ones, e.g. the files of a previous archive
+// installation. Argo CD loads the scripts of all subdirectories, so they would be loaded next to the new script.
+func removeStale(dir string, keep ...string) error {
+	entries, err := os.ReadDir(dir)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
+	for _, e := range entries {
+		if slices.Contains(keep, e.Name()) {
+			continue
+		}
+		slog.Info("Removing stale extension file", "path", filepath.Join(dir, e.Name()))
+		if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+			return err
+		}
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, u)
+	return nil
+}
+
+// writeAtomic writes the data to a temporary file in the same directory and renames it to the path, so Argo CD
+// serves either the previous or the new file, but never a partially written one.
+// The previous file is kept with the backup suffix.
+func writeAtomic(path string, data []byte) error {
+	if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, data) {
+		slog.Info("Extension is up to date", "path", path)
+		return nil
 	}
-	b, err := io.ReadAll(resp.Body)
+
+	// the temporary file is hidden and does not match the extension*.js pattern Argo CD loads
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
 	if err != nil {
-		return nil, err
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
 	}
-	return b, nil
+
+	backup := path + backupSuffix
+	if err := os.Remove(backup); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.Link(path, backup); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("Failed to keep a backup of the installed extension", "path", backup, "error", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Uninstall removes the touch extension directory including backups and leftovers of an interrupted archive
+// installation.
+func Uninstall() error {
+	dir := installDir()
+	// Argo CD would still load the scripts of leftover directories
+	if err := removeLeftovers(dir); err != nil {
+		return err
+	}
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		slog.Info("Extension is not installed", "dir", dir)
+		return nil
+	}
+	slog.Info("Removing extension", "dir", dir)
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	slog.Info("Extension successfully uninstalled")
+	return nil
 }
 
 // checksumHex returns the SHA256 hex string for the provided bytes.
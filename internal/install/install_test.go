@@ -0,0 +1,298 @@
+package install
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bakito/argocd-touch-extension/internal/extension"
+	"github.com/bakito/argocd-touch-extension/internal/server"
+	"github.com/bakito/argocd-touch-extension/internal/signature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newExtensionServer serves the script, an archive with the script, the checksums and the signatures created with
+// the given key.
+func newExtensionServer(t *testing.T, js []byte, key ed25519.PrivateKey) *httptest.Server {
+	t.Helper()
+	archive := tarGz(t, entry{name: "resources/" + extension.ExtensionJS, content: string(js)})
+	checksums := fmt.Appendf(nil, "%s  %s\n%s  %s\n",
+		checksumHex(archive), extension.ExtensionArchive, checksumHex(js), extension.ExtensionJS)
+	assets := map[string][]byte{
+		extension.ExtensionJS:      js,
+		extension.ExtensionArchive: archive,
+		server.ExtensionChecksum:   checksums,
+	}
+	if key != nil {
+		assets[extension.ExtensionJS+signature.Suffix] = signature.Sign(key, js)
+		assets[server.ExtensionChecksum+signature.Suffix] = signature.Sign(key, checksums)
+	}
+
+	mux := http.NewServeMux()
+	for name, data := range assets {
+		mux.HandleFunc(server.APIPathV1+server.APIPathExtension+name, func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write(data)
+		})
+	}
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestDoSignature(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		key       ed25519.PrivateKey
+		publicKey string
+		expectErr string
+	}{
+		{name: "not pinned", key: nil},
+		{name: "valid signature", key: key, publicKey: base64.StdEncoding.EncodeToString(pub)},
+		{
+			name:      "signed with another key",
+			key:       otherKey,
+			publicKey: base64.StdEncoding.EncodeToString(pub),
+			expectErr: signature.ErrInvalid.Error(),
+		},
+		{
+			name:      "unsigned",
+			key:       nil,
+			publicKey: base64.StdEncoding.EncodeToString(pub),
+			expectErr: "download signature",
+		},
+		{name: "invalid public key", key: key, publicKey: "invalid", expectErr: "invalid public key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newExtensionServer(t, []byte("console.log('touch')"), tt.key)
+			dir := t.TempDir()
+			t.Setenv(envExtensionBaseURL, srv.URL)
+			t.Setenv(envExtensionInstallationDir, dir)
+			t.Setenv(envExtensionPublicKey, "")
+
+			err := Do(t.Context(), Options{PublicKey: tt.publicKey})
+
+			installed := filepath.Join(dir, "touch", extension.ExtensionJS)
+			if tt.expectErr != "" {
+				require.ErrorContains(t, err, tt.expectErr)
+				assert.NoFileExists(t, installed)
+				return
+			}
+			require.NoError(t, err)
+			data, err := os.ReadFile(installed)
+			require.NoError(t, err)
+			assert.Equal(t, "console.log('touch')", string(data))
+		})
+	}
+}
+
+func TestDoArchive(t *testing.T) {
+	srv := newExtensionServer(t, []byte("console.log('touch')"), nil)
+	dir := t.TempDir()
+	t.Setenv(envExtensionBaseURL, srv.URL)
+	t.Setenv(envExtensionInstallationDir, dir)
+	t.Setenv(envExtensionPublicKey, "")
+
+	require.NoError(t, Do(t.Context(), Options{Archive: true}))
+
+	data, err := os.ReadFile(filepath.Join(dir, "touch", "resources", extension.ExtensionJS))
+	require.NoError(t, err)
+	assert.Equal(t, "console.log('touch')", string(data))
+}
+
+func TestInstall(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(envExtensionInstallationDir, dir)
+	extPath := filepath.Join(dir, "touch", extension.ExtensionJS)
+
+	require.NoError(t, install([]byte("v1")))
+	_, err := os.Stat(extPath + backupSuffix)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	require.NoError(t, install([]byte("v2")))
+	data, err := os.ReadFile(extPath)
+	require.NoError(t, err)
+	assert.Equal(t, "v2", string(data))
+	backup, err := os.ReadFile(extPath + backupSuffix)
+	require.NoError(t, err)
+	assert.Equal(t, "v1", string(backup))
+
+	fi, err := os.Stat(extPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o644), fi.Mode().Perm())
+
+	// unchanged content keeps the backup
+	require.NoError(t, install([]byte("v2")))
+	backup, err = os.ReadFile(extPath + backupSuffix)
+	require.NoError(t, err)
+	assert.Equal(t, "v1", string(backup))
+
+	// no temporary files are left behind
+	entries, err := os.ReadDir(filepath.Dir(extPath))
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestInstallRemovesArchiveFiles(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(envExtensionInstallationDir, dir)
+	resources := filepath.Join(dir, "touch", "resources")
+	require.NoError(t, os.MkdirAll(resources, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(resources, extension.ExtensionJS), []byte("archive"), 0o600))
+
+	require.NoError(t, install([]byte("script")))
+
+	_, err := os.Stat(resources)
+	require.ErrorIs(t, err, os.ErrNotExist, "the script of the archive would be loaded as well")
+	data, err := os.ReadFile(filepath.Join(dir, "touch", extension.ExtensionJS))
+	require.NoError(t, err)
+	assert.Equal(t, "script", string(data))
+}
+
+func TestUninstall(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(envExtensionInstallationDir, dir)
+
+	require.NoError(t, Uninstall())
+
+	require.NoError(t, install([]byte("v1")))
+	require.NoError(t, install([]byte("v2")))
+	require.NoError(t, Uninstall())
+	_, err := os.Stat(filepath.Join(dir, "touch"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+	_, err = os.Stat(dir)
+	assert.NoError(t, err)
+}
+
+// changingServer serves the script and its checksum, which supports conditional requests with the ETag.
+// The script can be replaced or the server can fail while the test runs.
+type changingServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	js        []byte
+	fail      bool
+	downloads atomic.Int32
+}
+
+func newChangingServer(t *testing.T, js string) *changingServer {
+	t.Helper()
+	s := &changingServer{js: []byte(js)}
+	mux := http.NewServeMux()
+	mux.HandleFunc(server.APIPathV1+server.APIPathExtension+extension.ExtensionJS,
+		func(w http.ResponseWriter, _ *http.Request) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			_, _ = w.Write(s.js)
+		})
+	mux.HandleFunc(server.APIPathV1+server.APIPathExtension+server.ExtensionChecksum,
+		func(w http.ResponseWriter, r *http.Request) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.fail {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			checksums := fmt.Appendf(nil, "%s  %s\n", checksumHex(s.js), extension.ExtensionJS)
+			etag := `"` + checksumHex(checksums) + `"`
+			w.Header().Set("ETag", etag)
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			s.downloads.Add(1)
+			_, _ = w.Write(checksums)
+		})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *changingServer) set(js string, fail bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.js = []byte(js)
+	s.fail = fail
+}
+
+func TestSync(t *testing.T) {
+	srv := newChangingServer(t, "v1")
+	dir := t.TempDir()
+	t.Setenv(envExtensionBaseURL, srv.URL)
+	t.Setenv(envExtensionInstallationDir, dir)
+	t.Setenv(envExtensionPublicKey, "")
+	extPath := filepath.Join(dir, "touch", extension.ExtensionJS)
+
+	i, err := newInstaller(Options{Backoff: time.Millisecond})
+	require.NoError(t, err)
+
+	etag, installed := i.sync(t.Context(), 0, "", nil)
+	assert.NotEmpty(t, etag)
+	assert.NotEmpty(t, installed)
+	assert.FileExists(t, extPath)
+
+	// unchanged
+	etag2, installed2 := i.sync(t.Context(), 0, etag, installed)
+	assert.Equal(t, etag, etag2)
+	assert.Equal(t, installed, installed2)
+	assert.Equal(t, int32(1), srv.downloads.Load())
+
+	// changed
+	srv.set("v2", false)
+	etag3, installed3 := i.sync(t.Context(), 0, etag2, installed2)
+	assert.NotEqual(t, etag2, etag3)
+	assert.NotEqual(t, installed2, installed3)
+	data, err := os.ReadFile(extPath)
+	require.NoError(t, err)
+	assert.Equal(t, "v2", string(data))
+
+	// failing server keeps the installed version and resets the ETag
+	srv.set("v3", true)
+	etag4, installed4 := i.sync(t.Context(), 0, etag3, installed3)
+	assert.Empty(t, etag4)
+	assert.Equal(t, installed3, installed4)
+	data, err = os.ReadFile(extPath)
+	require.NoError(t, err)
+	assert.Equal(t, "v2", string(data))
+}
+
+func TestWatch(t *testing.T) {
+	srv := newChangingServer(t, "v1")
+	dir := t.TempDir()
+	t.Setenv(envExtensionBaseURL, srv.URL)
+	t.Setenv(envExtensionInstallationDir, dir)
+	t.Setenv(envExtensionPublicKey, "")
+	extPath := filepath.Join(dir, "touch", extension.ExtensionJS)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error)
+	go func() { done <- Watch(ctx, Options{Interval: 10 * time.Millisecond, Backoff: time.Millisecond}) }()
+
+	installedVersion := func(v string) func() bool {
+		return func() bool {
+			data, err := os.ReadFile(extPath)
+			return err == nil && string(data) == v
+		}
+	}
+	assert.Eventually(t, installedVersion("v1"), time.Second, 10*time.Millisecond)
+	srv.set("v2", false)
+	assert.Eventually(t, installedVersion("v2"), time.Second, 10*time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+}
@@ -0,0 +1,118 @@
+package install
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bakito/argocd-touch-extension/internal/extension"
+	"github.com/bakito/argocd-touch-extension/internal/server"
+	"github.com/bakito/argocd-touch-extension/internal/signature"
+)
+
+// source provides the extension assets by their name on the touch service.
+type source interface {
+	read(ctx context.Context, name string) ([]byte, error)
+}
+
+// remote downloads the assets from the touch service at EXTENSION_BASE_URL.
+type remote struct {
+	d           *downloader
+	baseURL     string
+	readyURL    string
+	checksumURL string
+}
+
+func newRemote(opts Options) (*remote, error) {
+	baseURL, ok := os.LookupEnv(envExtensionBaseURL)
+	if !ok {
+		return nil, fmt.Errorf("missing environment variable: '%s'", envExtensionBaseURL)
+	}
+	d, err := newDownloader(opts)
+	if err != nil {
+		return nil, err
+	}
+	r := &remote{
+		d:        d,
+		baseURL:  baseURL,
+		readyURL: cmp.Or(opts.ReadyURL, os.Getenv(envExtensionReadyURL)),
+	}
+	if r.checksumURL, err = r.url(server.ExtensionChecksum); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *remote) url(name string) (string, error) {
+	u, err := url.JoinPath(r.baseURL, server.APIPathV1, server.APIPathExtension, name)
+	if err != nil {
+		return "", fmt.Errorf("build URL of %s: %w", name, err)
+	}
+	return u, nil
+}
+
+func (r *remote) read(ctx context.Context, name string) ([]byte, error) {
+	u, err := r.url(name)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("Downloading from", "url", u)
+	return r.d.readAll(ctx, u)
+}
+
+// waitReady waits for the ready URL if one is configured.
+func (r *remote) waitReady(ctx context.Context) error {
+	if r.readyURL == "" {
+		return nil
+	}
+	if err := r.d.waitReady(ctx, r.readyURL); err != nil {
+		return fmt.Errorf("wait for server: %w", err)
+	}
+	return nil
+}
+
+// fileSource reads the installed asset and its signature from the given file, all other assets from the directory
+// of the file.
+type fileSource struct {
+	file string
+	name string
+}
+
+func (s *fileSource) read(_ context.Context, name string) ([]byte, error) {
+	path := filepath.Join(filepath.Dir(s.file), name)
+	if suffix, ok := strings.CutPrefix(name, s.name); ok {
+		path = s.file + suffix
+	}
+	slog.Info("Reading from", "file", path)
+	return os.ReadFile(path)
+}
+
+// renderedSource provides the assets of the locally rendered extension.
+type renderedSource struct {
+	ext extension.Extension
+}
+
+func (s *renderedSource) read(_ context.Context, name string) ([]byte, error) {
+	switch name {
+	case extension.ExtensionJS:
+		js, _ := s.ext.ExtensionJS()
+		return js, nil
+	case extension.ExtensionArchive:
+		archive, _ := s.ext.ExtensionTarGz()
+		return archive, nil
+	case extension.ExtensionChecksum:
+		return s.ext.Checksums(), nil
+	}
+	if asset, ok := strings.CutSuffix(name, signature.Suffix); ok {
+		if sig, ok := s.ext.Signature(asset); ok {
+			return sig, nil
+		}
+		return nil, fmt.Errorf("%s is not signed, configure a signing key", asset)
+	}
+	return nil, fmt.Errorf("unknown asset %s", name)
+}
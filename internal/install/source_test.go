@@ -0,0 +1,181 @@
+package install
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bakito/argocd-touch-extension/internal/extension"
+	"github.com/bakito/argocd-touch-extension/internal/signature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeAssets writes the script, an archive with the script and the checksums into the directory.
+func writeAssets(t *testing.T, dir string, js []byte) map[string][]byte {
+	t.Helper()
+	archive := tarGz(t, entry{name: "resources/" + extension.ExtensionJS, content: string(js)})
+	assets := map[string][]byte{
+		extension.ExtensionJS:      js,
+		extension.ExtensionArchive: archive,
+		extension.ExtensionChecksum: fmt.Appendf(nil, "%s  %s\n%s  %s\n",
+			checksumHex(archive), extension.ExtensionArchive, checksumHex(js), extension.ExtensionJS),
+	}
+	for name, data := range assets {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o600))
+	}
+	return assets
+}
+
+func TestDoFromFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      string
+		rename    string
+		content   string
+		installed string
+		expectErr string
+	}{
+		{name: "script", file: extension.ExtensionJS, installed: extension.ExtensionJS},
+		{name: "archive", file: extension.ExtensionArchive, installed: filepath.Join("resources", extension.ExtensionJS)},
+		{
+			name:      "renamed archive",
+			file:      extension.ExtensionArchive,
+			rename:    "touch.tgz",
+			installed: filepath.Join("resources", extension.ExtensionJS),
+		},
+		{name: "modified", file: extension.ExtensionJS, content: "alert('x')", expectErr: "checksum mismatch"},
+		{name: "missing", file: "other.js", expectErr: "read extension"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := t.TempDir()
+			writeAssets(t, src, []byte("console.log('touch')"))
+			dir := t.TempDir()
+			t.Setenv(envExtensionBaseURL, "")
+			t.Setenv(envExtensionInstallationDir, dir)
+			t.Setenv(envExtensionPublicKey, "")
+
+			file := filepath.Join(src, tt.file)
+			if tt.rename != "" {
+				require.NoError(t, os.Rename(file, filepath.Join(src, tt.rename)))
+				file = filepath.Join(src, tt.rename)
+			}
+			if tt.content != "" {
+				require.NoError(t, os.WriteFile(file, []byte(tt.content), 0o600))
+			}
+
+			err := Do(t.Context(), Options{File: file})
+
+			if tt.expectErr != "" {
+				require.ErrorContains(t, err, tt.expectErr)
+				assert.NoDirExists(t, filepath.Join(dir, "touch"))
+				return
+			}
+			require.NoError(t, err)
+			data, err := os.ReadFile(filepath.Join(dir, "touch", tt.installed))
+			require.NoError(t, err)
+			assert.Equal(t, "console.log('touch')", string(data))
+		})
+	}
+}
+
+func TestDoFromFileSignature(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	src := t.TempDir()
+	assets := writeAssets(t, src, []byte("console.log('touch')"))
+	dir := t.TempDir()
+	t.Setenv(envExtensionInstallationDir, dir)
+	t.Setenv(envExtensionPublicKey, base64.StdEncoding.EncodeToString(pub))
+	file := filepath.Join(src, extension.ExtensionJS)
+
+	require.ErrorContains(t, Do(t.Context(), Options{File: file}), "read signature")
+
+	for _, name := range []string{extension.ExtensionJS, extension.ExtensionChecksum} {
+		require.NoError(t, os.WriteFile(filepath.Join(src, name+signature.Suffix), signature.Sign(key, assets[name]), 0o600))
+	}
+	require.NoError(t, Do(t.Context(), Options{File: file}))
+	assert.FileExists(t, filepath.Join(dir, "touch", extension.ExtensionJS))
+}
+
+// renderedExtension provides the assets of an extension rendered by the extension package.
+type renderedExtension struct {
+	extension.Extension
+	assets     map[string][]byte
+	signatures map[string][]byte
+}
+
+func (e *renderedExtension) ExtensionJS() ([]byte, string) {
+	return e.assets[extension.ExtensionJS], ""
+}
+
+func (e *renderedExtension) ExtensionTarGz() ([]byte, string) {
+	return e.assets[extension.ExtensionArchive], ""
+}
+
+func (e *renderedExtension) Checksums() []byte {
+	return e.assets[extension.ExtensionChecksum]
+}
+
+func (e *renderedExtension) Signature(name string) ([]byte, bool) {
+	sig, ok := e.signatures[name]
+	return sig, ok
+}
+
+func TestDoRendered(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		archive   bool
+		sign      bool
+		publicKey string
+		installed string
+		expectErr string
+	}{
+		{name: "script", installed: extension.ExtensionJS},
+		{name: "archive", archive: true, installed: filepath.Join("resources", extension.ExtensionJS)},
+		{
+			name:      "signed",
+			sign:      true,
+			publicKey: base64.StdEncoding.EncodeToString(pub),
+			installed: extension.ExtensionJS,
+		},
+		{name: "unsigned", publicKey: base64.StdEncoding.EncodeToString(pub), expectErr: "not signed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ext := &renderedExtension{assets: writeAssets(t, t.TempDir(), []byte("console.log('touch')"))}
+			if tt.sign {
+				ext.signatures = map[string][]byte{}
+				for name, data := range ext.assets {
+					ext.signatures[name] = signature.Sign(key, data)
+				}
+			}
+			dir := t.TempDir()
+			t.Setenv(envExtensionInstallationDir, dir)
+			t.Setenv(envExtensionPublicKey, "")
+
+			err := Do(t.Context(), Options{Extension: ext, Archive: tt.archive, PublicKey: tt.publicKey})
+
+			if tt.expectErr != "" {
+				require.ErrorContains(t, err, tt.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			data, err := os.ReadFile(filepath.Join(dir, "touch", tt.installed))
+			require.NoError(t, err)
+			assert.Equal(t, "console.log('touch')", string(data))
+		})
+	}
+}
+
+func TestWatchRequiresService(t *testing.T) {
+	require.ErrorContains(t, Watch(t.Context(), Options{File: extension.ExtensionJS}), "requires downloading")
+}
@@ -0,0 +1,85 @@
+package install
+
+import (
+	"cmp"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// newHTTPClient returns the client of the downloader with the configured CA bundle, client certificate and proxy.
+// Without a proxy option, the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables are used.
+func newHTTPClient(opts Options) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile := cmp.Or(opts.CAFile, os.Getenv(envExtensionCAFile)); caFile != "" {
+		pool, err := loadCAs(caFile)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+
+	certFile := cmp.Or(opts.ClientCertFile, os.Getenv(envExtensionClientCertFile))
+	keyFile := cmp.Or(opts.ClientKeyFile, os.Getenv(envExtensionClientKeyFile))
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, errors.New("client certificate and key must be set together")
+		}
+		if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		// loaded with each handshake, so the sidecar picks up renewed certificates
+		transport.TLSClientConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load client certificate: %w", err)
+			}
+			return &cert, nil
+		}
+	}
+
+	if proxy := cmp.Or(opts.Proxy, os.Getenv(envExtensionProxy)); proxy != "" {
+		u, err := url.Parse(proxy)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", proxy)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+
+	return &http.Client{Timeout: httpTimeout, Transport: transport}, nil
+}
+
+// loadCAs returns the system roots extended by the certificates of the PEM bundle.
+func loadCAs(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ca bundle: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("ca bundle %q contains no certificates", file)
+	}
+	return pool, nil
+}
+
+// bearerToken returns the configured token, the token file is read with each request to pick up rotated tokens.
+func (d *downloader) bearerToken() (string, error) {
+	if d.tokenFile == "" {
+		return d.token, nil
+	}
+	data, err := os.ReadFile(d.tokenFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,205 @@
+package install
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCert writes a self-signed certificate and its key and returns the file names.
+func writeCert(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile = filepath.Join(dir, "tls.crt")
+	keyFile = filepath.Join(dir, "tls.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600))
+	return certFile, keyFile
+}
+
+// writeServerCA writes the certificate of the TLS test server as CA bundle.
+func writeServerCA(t *testing.T, srv *httptest.Server) string {
+	t.Helper()
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, data, 0o600))
+	return caFile
+}
+
+func TestDownloaderTLS(t *testing.T) {
+	clientDir := t.TempDir()
+	certFile, keyFile := writeCert(t, clientDir)
+	clientCAs := x509.NewCertPool()
+	data, err := os.ReadFile(certFile)
+	require.NoError(t, err)
+	require.True(t, clientCAs.AppendCertsFromPEM(data))
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("body"))
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs, MinVersion: tls.VersionTLS12}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	caFile := writeServerCA(t, srv)
+
+	tests := []struct {
+		name      string
+		opts      Options
+		expectErr string
+	}{
+		{
+			name: "trusted with client certificate",
+			opts: Options{CAFile: caFile, ClientCertFile: certFile, ClientKeyFile: keyFile},
+		},
+		{name: "untrusted", opts: Options{ClientCertFile: certFile, ClientKeyFile: keyFile}, expectErr: "certificate"},
+		{name: "without client certificate", opts: Options{CAFile: caFile}, expectErr: "certificate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := newDownloader(tt.opts)
+			require.NoError(t, err)
+
+			b, err := d.readOnce(t.Context(), srv.URL)
+
+			if tt.expectErr != "" {
+				require.ErrorContains(t, err, tt.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "body", string(b))
+		})
+	}
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	certFile, keyFile := writeCert(t, t.TempDir())
+	invalid := filepath.Join(t.TempDir(), "invalid.crt")
+	require.NoError(t, os.WriteFile(invalid, []byte("invalid"), 0o600))
+
+	tests := []struct {
+		name      string
+		opts      Options
+		expectErr string
+	}{
+		{name: "default"},
+		{name: "ca bundle", opts: Options{CAFile: certFile}},
+		{name: "missing ca bundle", opts: Options{CAFile: "missing.crt"}, expectErr: "failed to read ca bundle"},
+		{name: "invalid ca bundle", opts: Options{CAFile: invalid}, expectErr: "contains no certificates"},
+		{name: "client certificate", opts: Options{ClientCertFile: certFile, ClientKeyFile: keyFile}},
+		{name: "client certificate without key", opts: Options{ClientCertFile: certFile}, expectErr: "set together"},
+		{
+			name:      "invalid client certificate",
+			opts:      Options{ClientCertFile: invalid, ClientKeyFile: keyFile},
+			expectErr: "failed to load client certificate",
+		},
+		{name: "proxy", opts: Options{Proxy: "http://proxy:3128"}},
+		{name: "proxy without scheme", opts: Options{Proxy: "proxy:3128"}, expectErr: "invalid proxy URL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, env := range []string{
+				envExtensionCAFile, envExtensionClientCertFile, envExtensionClientKeyFile, envExtensionProxy,
+			} {
+				t.Setenv(env, "")
+			}
+
+			_, err := newHTTPClient(tt.opts)
+
+			if tt.expectErr != "" {
+				require.ErrorContains(t, err, tt.expectErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestDownloaderProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		_, _ = w.Write([]byte("body"))
+	}))
+	t.Cleanup(proxy.Close)
+
+	d, err := newDownloader(Options{Proxy: proxy.URL})
+	require.NoError(t, err)
+
+	b, err := d.readOnce(t.Context(), "http://touch.example/v1/extension/extension-touch.js")
+	require.NoError(t, err)
+	assert.Equal(t, "body", string(b))
+	assert.Equal(t, "http://touch.example/v1/extension/extension-touch.js", proxied)
+}
+
+func TestDownloaderBearerToken(t *testing.T) {
+	var authorization string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+	}))
+	t.Cleanup(srv.Close)
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("first\n"), 0o600))
+
+	tests := []struct {
+		name      string
+		opts      Options
+		rotate    bool
+		expected  string
+		expectErr string
+	}{
+		{name: "none", expected: ""},
+		{name: "token", opts: Options{Token: "secret"}, expected: "Bearer secret"},
+		{name: "token file", opts: Options{Token: "secret", TokenFile: tokenFile}, expected: "Bearer first"},
+		{name: "rotated token file", opts: Options{TokenFile: tokenFile}, rotate: true, expected: "Bearer second"},
+		{name: "missing token file", opts: Options{TokenFile: "missing"}, expectErr: "failed to read token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(envExtensionToken, "")
+			t.Setenv(envExtensionTokenFile, "")
+			authorization = ""
+			d, err := newDownloader(tt.opts)
+			require.NoError(t, err)
+			if tt.rotate {
+				require.NoError(t, os.WriteFile(tokenFile, []byte("second"), 0o600))
+			}
+
+			_, err = d.readOnce(t.Context(), srv.URL)
+
+			if tt.expectErr != "" {
+				require.ErrorContains(t, err, tt.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, authorization)
+		})
+	}
+}
@@ -2,23 +2,58 @@ package k8s
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log/slog"
 
 	"github.com/bakito/argocd-touch-extension/internal/config"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
 type Client interface {
-	PatchAnnotation(ctx context.Context, res config.Resource, namespace, name, annotationKey, annotationValue string) error
+	Get(ctx context.Context, res config.Resource, namespace, name string) (*unstructured.Unstructured, error)
+	// List returns the objects matching the label selector, an empty namespace lists all namespaces.
+	List(ctx context.Context, res config.Resource, namespace, selector string) ([]unstructured.Unstructured, error)
+	// PatchAnnotations merges the annotations into the object.
+	// If a resource version is given, the patch fails with a conflict if the object was modified meanwhile.
+	PatchAnnotations(
+		ctx context.Context,
+		res config.Resource,
+		namespace, name string,
+		annotations map[string]string,
+		resourceVersion string,
+		dryRun bool,
+	) (*unstructured.Unstructured, error)
+	Resolver
+	// Watch watches the object starting after the given resource version, reconnecting if the watch is closed.
+	Watch(ctx context.Context, res config.Resource, namespace, name, resourceVersion string) (watch.Interface, error)
+	// Ping checks the connectivity to the API server.
+	Ping(ctx context.Context) error
+}
+
+// Resolver sets the name and version of the resources that are not configured.
+type Resolver interface {
 	SetNameAndVersion(resources map[string]config.Resource) (map[string]config.Resource, error)
 }
 
+// StaticResolver is a Resolver without API server, names and versions that are not configured are left empty.
+// The extension script and archive do not depend on them, only the rendered RBAC rules do.
+type StaticResolver struct{}
+
+func (StaticResolver) SetNameAndVersion(resMap map[string]config.Resource) (map[string]config.Resource, error) {
+	return resMap, nil
+}
+
 type client struct {
 	dynamic   dynamic.Interface
 	discovery discovery.DiscoveryInterface
@@ -72,6 +107,10 @@ func (cl *client) SetNameAndVersion(resMap map[string]config.Resource) (map[stri
 	return resMap, nil
 }
 
+func (cl *client) Ping(ctx context.Context) error {
+	return cl.discovery.RESTClient().Get().AbsPath("/version").Do(ctx).Error()
+}
+
 func (cl *client) GetNameAndVersion(resources []*metav1.APIResourceList, group, kind string) (name, version string, err error) {
 	for _, list := range resources {
 		if list == nil {
@@ -95,14 +134,64 @@ func (cl *client) GetNameAndVersion(resources []*metav1.APIResourceList, group,
 	return "", "", fmt.Errorf("no preferred version found for group %s and kind %s", group, kind)
 }
 
-func (cl *client) PatchAnnotation(ctx context.Context, res config.Resource, namespace, name, annotation, value string) error {
-	rc := cl.dynamic.Resource(schema.GroupVersionResource{Group: res.Group, Version: res.Version, Resource: res.Name}).
+func (cl *client) resourceClient(res config.Resource, namespace string) dynamic.ResourceInterface {
+	return cl.dynamic.Resource(schema.GroupVersionResource{Group: res.Group, Version: res.Version, Resource: res.Name}).
 		Namespace(namespace)
+}
+
+func (cl *client) Get(ctx context.Context, res config.Resource, namespace, name string) (*unstructured.Unstructured, error) {
+	return cl.resourceClient(res, namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+func (cl *client) List(
+	ctx context.Context,
+	res config.Resource,
+	namespace, selector string,
+) ([]unstructured.Unstructured, error) {
+	list, err := cl.resourceClient(res, namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
 
-	_, err := rc.Patch(ctx,
-		name, types.MergePatchType,
-		[]byte(fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, annotation, value)),
-		metav1.PatchOptions{},
-	)
-	return err
+func (cl *client) PatchAnnotations(
+	ctx context.Context,
+	res config.Resource,
+	namespace, name string,
+	annotations map[string]string,
+	resourceVersion string,
+	dryRun bool,
+) (*unstructured.Unstructured, error) {
+	metadata := map[string]any{"annotations": annotations}
+	if resourceVersion != "" {
+		// the api server rejects the patch if the resource version does not match
+		metadata["resourceVersion"] = resourceVersion
+	}
+	patch, err := json.Marshal(map[string]any{"metadata": metadata})
+	if err != nil {
+		return nil, err
+	}
+
+	opts := metav1.PatchOptions{}
+	if dryRun {
+		opts.DryRun = []string{metav1.DryRunAll}
+	}
+
+	return cl.resourceClient(res, namespace).Patch(ctx, name, types.MergePatchType, patch, opts)
+}
+
+func (cl *client) Watch(
+	ctx context.Context,
+	res config.Resource,
+	namespace, name, resourceVersion string,
+) (watch.Interface, error) {
+	rc := cl.resourceClient(res, namespace)
+	lw := &cache.ListWatch{
+		WatchFuncWithContext: func(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+			opts.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+			return rc.Watch(ctx, opts)
+		},
+	}
+	return watchtools.NewRetryWatcherWithContext(ctx, resourceVersion, lw)
 }
@@ -0,0 +1,38 @@
+package k8s
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/bakito/argocd-touch-extension/internal/config"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// IsTransient returns true for errors that may succeed on retry: throttling, server errors and timeouts.
+func IsTransient(err error) bool {
+	if kerr.IsTooManyRequests(err) ||
+		kerr.IsServerTimeout(err) ||
+		kerr.IsTimeout(err) ||
+		kerr.IsInternalError(err) ||
+		kerr.IsServiceUnavailable(err) {
+		return true
+	}
+	var status kerr.APIStatus
+	if errors.As(err, &status) && status.Status().Code >= 500 {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// backoff returns the backoff of the retry config, the delay doubles with each retry.
+func backoff(cfg config.Retry) wait.Backoff {
+	return wait.Backoff{
+		Steps:    max(cfg.Attempts, 1),
+		Duration: max(cfg.Backoff.Duration, time.Millisecond),
+		Factor:   2,
+		Jitter:   0.1,
+	}
+}
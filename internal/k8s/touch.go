@@ -0,0 +1,152 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/bakito/argocd-touch-extension/internal/config"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	AnnotationTouch        = "argocd.bakito.ch/touch"
+	AnnotationTouchHistory = "argocd.bakito.ch/touch-history"
+
+	userSeparator = " by: "
+)
+
+// TouchRecord is a single touch of an object.
+type TouchRecord struct {
+	Time time.Time `json:"time"`
+	User string    `json:"user,omitempty"`
+}
+
+// Value returns the value of the touch annotation.
+func (r TouchRecord) Value() string {
+	value := r.Time.Format(time.RFC3339)
+	if r.User != "" {
+		value += userSeparator + r.User
+	}
+	return value
+}
+
+// ParseTouchValue parses the value of the touch annotation.
+func ParseTouchValue(value string) (TouchRecord, bool) {
+	ts, user, _ := strings.Cut(value, userSeparator)
+	t, err := time.Parse(time.RFC3339, ts)
+	if err != nil {
+		return TouchRecord{}, false
+	}
+	return TouchRecord{Time: t, User: user}, true
+}
+
+// TouchState is the touch related state of an object.
+type TouchState struct {
+	Namespace          string        `json:"namespace"`
+	Name               string        `json:"name"`
+	ResourceVersion    string        `json:"resourceVersion"`
+	Generation         int64         `json:"generation,omitempty"`
+	LastTouch          *TouchRecord  `json:"lastTouch,omitempty"`
+	History            []TouchRecord `json:"history,omitempty"`
+	ObservedGeneration int64         `json:"observedGeneration,omitempty"`
+	Conditions         []any         `json:"conditions,omitempty"`
+}
+
+// StateOf extracts the touch state of the given object.
+func StateOf(obj *unstructured.Unstructured) TouchState {
+	state := TouchState{
+		Namespace:       obj.GetNamespace(),
+		Name:            obj.GetName(),
+		ResourceVersion: obj.GetResourceVersion(),
+		Generation:      obj.GetGeneration(),
+		History:         history(obj),
+	}
+	if r, ok := ParseTouchValue(obj.GetAnnotations()[AnnotationTouch]); ok {
+		state.LastTouch = &r
+	}
+	state.ObservedGeneration, _, _ = unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	state.Conditions, _, _ = unstructured.NestedSlice(obj.Object, "status", "conditions")
+	return state
+}
+
+// history returns the touch history of the object, the newest touch first.
+func history(obj *unstructured.Unstructured) []TouchRecord {
+	var records []TouchRecord
+	if value, ok := obj.GetAnnotations()[AnnotationTouchHistory]; ok {
+		_ = json.Unmarshal([]byte(value), &records)
+	}
+	return records
+}
+
+// TouchOptions configure a touch.
+type TouchOptions struct {
+	DryRun bool
+	Retry  config.Retry
+}
+
+// TouchResult is the outcome of a touch.
+type TouchResult struct {
+	// Object is the patched object, or the object as it would be patched in dry run mode.
+	Object *unstructured.Unstructured
+	// Attempts is the number of patch attempts including retries.
+	Attempts int
+}
+
+// Touch sets the touch annotation of the given object.
+// If the resource keeps a history, the touch is also added to the history annotation. The history is patched with
+// the resource version of the read object as precondition and read again on conflicts, to not lose concurrent touches.
+// Transient errors of the api server and conflicts are retried with backoff, within the attempts of the retry config.
+func Touch(
+	ctx context.Context,
+	cl Client,
+	res config.Resource,
+	namespace, name, user string,
+	opts TouchOptions,
+) (TouchResult, error) {
+	record := TouchRecord{Time: time.Now().Truncate(time.Second), User: user}
+	var result TouchResult
+
+	patch := func() error {
+		result.Attempts++
+		annotations := map[string]string{AnnotationTouch: record.Value()}
+		var resourceVersion string
+
+		if res.HistoryLimit > 0 {
+			obj, err := cl.Get(ctx, res, namespace, name)
+			if err != nil {
+				return err
+			}
+			records := append([]TouchRecord{record}, history(obj)...)
+			if len(records) > res.HistoryLimit {
+				records = records[:res.HistoryLimit]
+			}
+			h, err := json.Marshal(records)
+			if err != nil {
+				return err
+			}
+			annotations[AnnotationTouchHistory] = string(h)
+			resourceVersion = obj.GetResourceVersion()
+		}
+
+		obj, err := cl.PatchAnnotations(ctx, res, namespace, name, annotations, resourceVersion, opts.DryRun)
+		if err != nil {
+			return err
+		}
+		result.Object = obj
+		return nil
+	}
+
+	// conflicts and transient errors share the attempts of the retry config
+	retriable := func(err error) bool {
+		if ctx.Err() != nil {
+			return false
+		}
+		return IsTransient(err) || (res.HistoryLimit > 0 && kerr.IsConflict(err))
+	}
+	err := retry.OnError(backoff(opts.Retry), retriable, patch)
+	return result, err
+}
@@ -0,0 +1,227 @@
+package k8s
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bakito/argocd-touch-extension/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var configMaps = config.Resource{Version: "v1", Kind: "ConfigMap", Name: "configmaps"}
+
+func newConfigMap(annotations map[string]any) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]any{
+			"namespace":   "default",
+			"name":        "test",
+			"annotations": annotations,
+		},
+	}}
+}
+
+func newFakeClient(objects ...runtime.Object) *client {
+	return &client{dynamic: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), objects...)}
+}
+
+func TestParseTouchValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected TouchRecord
+		ok       bool
+	}{
+		{
+			name:     "with user",
+			value:    "2025-01-02T03:04:05Z by: alice",
+			expected: TouchRecord{Time: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC), User: "alice"},
+			ok:       true,
+		},
+		{
+			name:     "without user",
+			value:    "2025-01-02T03:04:05Z",
+			expected: TouchRecord{Time: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)},
+			ok:       true,
+		},
+		{name: "invalid", value: "yesterday"},
+		{name: "empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, ok := ParseTouchValue(tt.value)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, r)
+			if ok {
+				assert.Equal(t, tt.value, r.Value())
+			}
+		})
+	}
+}
+
+func TestStateOf(t *testing.T) {
+	obj := newConfigMap(map[string]any{
+		AnnotationTouch:        "2025-01-02T03:04:05Z by: alice",
+		AnnotationTouchHistory: `[{"time":"2025-01-02T03:04:05Z","user":"alice"},{"time":"2025-01-01T03:04:05Z"}]`,
+	})
+	obj.Object["status"] = map[string]any{
+		"observedGeneration": int64(3),
+		"conditions":         []any{map[string]any{"type": "Ready", "status": "True"}},
+	}
+
+	state := StateOf(obj)
+
+	assert.Equal(t, "default", state.Namespace)
+	assert.Equal(t, "test", state.Name)
+	require.NotNil(t, state.LastTouch)
+	assert.Equal(t, "alice", state.LastTouch.User)
+	assert.Len(t, state.History, 2)
+	assert.Equal(t, int64(3), state.ObservedGeneration)
+	assert.Len(t, state.Conditions, 1)
+}
+
+func TestTouch(t *testing.T) {
+	t.Run("without history", func(t *testing.T) {
+		cl := newFakeClient(newConfigMap(nil))
+
+		result, err := Touch(t.Context(), cl, configMaps, "default", "test", "alice", TouchOptions{})
+		require.NoError(t, err)
+		obj := result.Object
+		assert.Equal(t, 1, result.Attempts)
+
+		r, ok := ParseTouchValue(obj.GetAnnotations()[AnnotationTouch])
+		assert.True(t, ok)
+		assert.Equal(t, "alice", r.User)
+		assert.NotContains(t, obj.GetAnnotations(), AnnotationTouchHistory)
+	})
+
+	t.Run("with history", func(t *testing.T) {
+		cl := newFakeClient(newConfigMap(map[string]any{
+			AnnotationTouchHistory: `[{"time":"2025-01-02T03:04:05Z","user":"bob"},{"time":"2025-01-01T03:04:05Z"}]`,
+		}))
+		res := configMaps
+		res.HistoryLimit = 2
+
+		result, err := Touch(t.Context(), cl, res, "default", "test", "alice", TouchOptions{})
+		require.NoError(t, err)
+		obj := result.Object
+
+		h := StateOf(obj).History
+		require.Len(t, h, 2)
+		assert.Equal(t, "alice", h[0].User)
+		assert.Equal(t, "bob", h[1].User)
+	})
+}
+
+func TestTouchRetry(t *testing.T) {
+	gr := schema.GroupResource{Resource: "configmaps"}
+	tests := []struct {
+		name             string
+		historyLimit     int
+		errors           []error
+		expectedAttempts int
+		expectedError    bool
+	}{
+		{
+			name:             "too many requests",
+			errors:           []error{kerr.NewTooManyRequests("slow down", 1)},
+			expectedAttempts: 2,
+		},
+		{
+			name: "server errors",
+			errors: []error{
+				kerr.NewServiceUnavailable("unavailable"),
+				kerr.NewInternalError(errors.New("boom")),
+			},
+			expectedAttempts: 3,
+		},
+		{
+			name: "attempts exhausted",
+			errors: []error{
+				kerr.NewTimeoutError("timeout", 1),
+				kerr.NewTimeoutError("timeout", 1),
+				kerr.NewTimeoutError("timeout", 1),
+			},
+			expectedAttempts: 3,
+			expectedError:    true,
+		},
+		{
+			name:             "forbidden is not retried",
+			errors:           []error{kerr.NewForbidden(gr, "test", errors.New("denied"))},
+			expectedAttempts: 1,
+			expectedError:    true,
+		},
+		{
+			name:             "conflict without history is not retried",
+			errors:           []error{kerr.NewConflict(gr, "test", errors.New("modified"))},
+			expectedAttempts: 1,
+			expectedError:    true,
+		},
+		{
+			name:             "conflict with history reads the object again",
+			historyLimit:     2,
+			errors:           []error{kerr.NewConflict(gr, "test", errors.New("modified"))},
+			expectedAttempts: 2,
+		},
+		{
+			name:         "conflicts and transient errors share the attempts",
+			historyLimit: 2,
+			errors: []error{
+				kerr.NewConflict(gr, "test", errors.New("modified")),
+				kerr.NewTimeoutError("timeout", 1),
+				kerr.NewConflict(gr, "test", errors.New("modified")),
+			},
+			expectedAttempts: 3,
+			expectedError:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := newConfigMap(nil)
+			obj.SetResourceVersion("42")
+			cl := newFakeClient(obj)
+			var patches []string
+			cl.dynamic.(*dynamicfake.FakeDynamicClient).PrependReactor("patch", "configmaps",
+				func(action k8stesting.Action) (bool, runtime.Object, error) {
+					patches = append(patches, string(action.(k8stesting.PatchAction).GetPatch()))
+					if len(patches) <= len(tt.errors) {
+						return true, nil, tt.errors[len(patches)-1]
+					}
+					return false, nil, nil
+				})
+			res := configMaps
+			res.HistoryLimit = tt.historyLimit
+
+			result, err := Touch(t.Context(), cl, res, "default", "test", "alice", TouchOptions{
+				Retry: config.Retry{Attempts: 3, Backoff: config.Duration{Duration: time.Millisecond}},
+			})
+
+			if tt.expectedError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.NotNil(t, result.Object)
+			}
+			assert.Equal(t, tt.expectedAttempts, result.Attempts)
+			assert.Len(t, patches, tt.expectedAttempts)
+			for _, p := range patches {
+				if tt.historyLimit > 0 {
+					assert.Contains(t, p, `"resourceVersion":"42"`)
+				} else {
+					assert.NotContains(t, p, "resourceVersion")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/bakito/argocd-touch-extension/internal/config"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const defaultWaitTimeout = 30 * time.Second
+
+type WaitResult string
+
+const (
+	WaitResultReconciled WaitResult = "Reconciled"
+	WaitResultFailed     WaitResult = "Failed"
+	WaitResultTimeout    WaitResult = "Timeout"
+)
+
+// WaitStatus is the outcome of waiting for the reconciliation of a touched object.
+type WaitStatus struct {
+	Result          WaitResult `json:"result"`
+	Message         string     `json:"message,omitempty"`
+	ResourceVersion string     `json:"resourceVersion,omitempty"`
+	Duration        string     `json:"duration"`
+}
+
+// WaitForReconcile watches the touched object until the wait criterion of the resource is met or the timeout is reached.
+// The progress func is called with a message for each observed change of the object.
+func WaitForReconcile(
+	ctx context.Context,
+	cl Client,
+	res config.Resource,
+	touched *unstructured.Unstructured,
+	progress func(message string),
+) (WaitStatus, error) {
+	start := time.Now()
+	status := func(result WaitResult, msg, rv string) WaitStatus {
+		return WaitStatus{
+			Result:          result,
+			Message:         msg,
+			ResourceVersion: rv,
+			Duration:        time.Since(start).Round(time.Millisecond).String(),
+		}
+	}
+
+	timeout := res.WaitFor.Timeout.Duration
+	if timeout <= 0 {
+		timeout = defaultWaitTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	w, err := cl.Watch(ctx, res, touched.GetNamespace(), touched.GetName(), touched.GetResourceVersion())
+	if err != nil {
+		return WaitStatus{}, err
+	}
+	defer w.Stop()
+
+	lastRV := touched.GetResourceVersion()
+	for {
+		select {
+		case <-ctx.Done():
+			return status(WaitResultTimeout, "Timed out after "+timeout.String(), lastRV), nil
+		case e, ok := <-w.ResultChan():
+			if !ok {
+				return status(WaitResultTimeout, "Watch closed", lastRV), nil
+			}
+			switch e.Type {
+			case watch.Deleted:
+				return status(WaitResultFailed, "Object was deleted", lastRV), nil
+			case watch.Error:
+				return WaitStatus{}, fmt.Errorf("watch failed: %v", e.Object)
+			case watch.Added, watch.Modified:
+			default:
+				continue
+			}
+
+			current, ok := e.Object.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+			lastRV = current.GetResourceVersion()
+
+			result, msg := checkReconciled(res.WaitFor, touched, current)
+			if progress != nil {
+				progress(msg)
+			}
+			if result != "" {
+				return status(result, msg, lastRV), nil
+			}
+		}
+	}
+}
+
+// checkReconciled evaluates the wait criterion against the current state of the object.
+// An empty result means the object is not reconciled yet.
+func checkReconciled(wf *config.WaitFor, touched, current *unstructured.Unstructured) (WaitResult, string) {
+	switch {
+	case wf.Condition != nil:
+		return checkCondition(wf.Condition, touched, current)
+	case wf.Field != "":
+		path := strings.Split(wf.Field, ".")
+		before, _, _ := unstructured.NestedFieldNoCopy(touched.Object, path...)
+		after, _, _ := unstructured.NestedFieldNoCopy(current.Object, path...)
+		if !reflect.DeepEqual(before, after) {
+			return WaitResultReconciled, fmt.Sprintf("%s changed to %v", wf.Field, after)
+		}
+		return "", wf.Field + " unchanged"
+	case wf.ObservedGeneration:
+		// an annotation patch does not bump the generation, so the status must also be written after the touch
+		observed, _, _ := unstructured.NestedInt64(current.Object, "status", "observedGeneration")
+		if observed < current.GetGeneration() {
+			return "", fmt.Sprintf("Observed generation %d of %d", observed, current.GetGeneration())
+		}
+		before, _, _ := unstructured.NestedFieldNoCopy(touched.Object, "status")
+		after, _, _ := unstructured.NestedFieldNoCopy(current.Object, "status")
+		if reflect.DeepEqual(before, after) {
+			return "", "Status unchanged"
+		}
+		return WaitResultReconciled, fmt.Sprintf("Generation %d observed", observed)
+	default:
+		return WaitResultReconciled, "Resource version changed to " + current.GetResourceVersion()
+	}
+}
+
+func checkCondition(wc *config.WaitCondition, touched, current *unstructured.Unstructured) (WaitResult, string) {
+	cond, found := findCondition(current, wc.Type)
+	if !found {
+		return "", fmt.Sprintf("Condition %s not found", wc.Type)
+	}
+
+	status, _, _ := unstructured.NestedString(cond, "status")
+	msg := fmt.Sprintf("Condition %s is %s", wc.Type, status)
+	if m, _, _ := unstructured.NestedString(cond, "message"); m != "" {
+		msg += ": " + m
+	}
+	if status == wc.Status {
+		return WaitResultReconciled, msg
+	}
+
+	// the condition only counts as failed if it changed to the opposite terminal status after the touch,
+	// intermediate states like Unknown while reconciling and changes of the reason or message are awaited
+	if opposite, ok := oppositeStatus[wc.Status]; !ok || status != opposite {
+		return "", msg
+	}
+	if before, ok := findCondition(touched, wc.Type); ok && before["status"] == status {
+		return "", msg
+	}
+	return WaitResultFailed, msg
+}
+
+// oppositeStatus maps the terminal condition statuses to each other.
+var oppositeStatus = map[string]string{
+	"True":  "False",
+	"False": "True",
+}
+
+func findCondition(obj *unstructured.Unstructured, conditionType string) (map[string]any, bool) {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]any)
+		if ok && cond["type"] == conditionType {
+			return cond, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,220 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bakito/argocd-touch-extension/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+type watchClient struct {
+	Client
+	watcher *watch.FakeWatcher
+}
+
+func (w *watchClient) Watch(_ context.Context, _ config.Resource, _, _, _ string) (watch.Interface, error) {
+	return w.watcher, nil
+}
+
+func withStatus(rv string, generation int64, status map[string]any) *unstructured.Unstructured {
+	obj := newConfigMap(nil)
+	obj.SetResourceVersion(rv)
+	obj.SetGeneration(generation)
+	if status != nil {
+		obj.Object["status"] = status
+	}
+	return obj
+}
+
+func readyCondition(status, message string) map[string]any {
+	return map[string]any{"conditions": []any{
+		map[string]any{"type": "Ready", "status": status, "message": message},
+	}}
+}
+
+func TestCheckReconciled(t *testing.T) {
+	tests := []struct {
+		name     string
+		waitFor  config.WaitFor
+		touched  *unstructured.Unstructured
+		current  *unstructured.Unstructured
+		expected WaitResult
+	}{
+		{
+			name:     "condition reached",
+			waitFor:  config.WaitFor{Condition: &config.WaitCondition{Type: "Ready", Status: "True"}},
+			touched:  withStatus("1", 1, readyCondition("True", "")),
+			current:  withStatus("2", 1, readyCondition("True", "refreshed")),
+			expected: WaitResultReconciled,
+		},
+		{
+			name:     "condition changed to other status",
+			waitFor:  config.WaitFor{Condition: &config.WaitCondition{Type: "Ready", Status: "True"}},
+			touched:  withStatus("1", 1, readyCondition("True", "")),
+			current:  withStatus("2", 1, readyCondition("False", "secret not found")),
+			expected: WaitResultFailed,
+		},
+		{
+			name:     "condition unchanged other status",
+			waitFor:  config.WaitFor{Condition: &config.WaitCondition{Type: "Ready", Status: "True"}},
+			touched:  withStatus("1", 1, readyCondition("False", "pending")),
+			current:  withStatus("2", 1, readyCondition("False", "pending")),
+			expected: "",
+		},
+		{
+			name:     "condition changed to unknown",
+			waitFor:  config.WaitFor{Condition: &config.WaitCondition{Type: "Ready", Status: "True"}},
+			touched:  withStatus("1", 1, readyCondition("True", "")),
+			current:  withStatus("2", 1, readyCondition("Unknown", "reconciling")),
+			expected: "",
+		},
+		{
+			name:     "condition changed from unknown",
+			waitFor:  config.WaitFor{Condition: &config.WaitCondition{Type: "Ready", Status: "True"}},
+			touched:  withStatus("1", 1, readyCondition("Unknown", "reconciling")),
+			current:  withStatus("2", 1, readyCondition("True", "")),
+			expected: WaitResultReconciled,
+		},
+		{
+			name:     "condition changed from unknown to other status",
+			waitFor:  config.WaitFor{Condition: &config.WaitCondition{Type: "Ready", Status: "True"}},
+			touched:  withStatus("1", 1, readyCondition("Unknown", "reconciling")),
+			current:  withStatus("2", 1, readyCondition("False", "secret not found")),
+			expected: WaitResultFailed,
+		},
+		{
+			name:     "condition message changed other status",
+			waitFor:  config.WaitFor{Condition: &config.WaitCondition{Type: "Ready", Status: "True"}},
+			touched:  withStatus("1", 1, readyCondition("False", "pending")),
+			current:  withStatus("2", 1, readyCondition("False", "retrying")),
+			expected: "",
+		},
+		{
+			name:     "condition missing",
+			waitFor:  config.WaitFor{Condition: &config.WaitCondition{Type: "Ready", Status: "True"}},
+			touched:  withStatus("1", 1, nil),
+			current:  withStatus("2", 1, nil),
+			expected: "",
+		},
+		{
+			name:     "field changed",
+			waitFor:  config.WaitFor{Field: "status.refreshTime"},
+			touched:  withStatus("1", 1, map[string]any{"refreshTime": "a"}),
+			current:  withStatus("2", 1, map[string]any{"refreshTime": "b"}),
+			expected: WaitResultReconciled,
+		},
+		{
+			name:     "field unchanged",
+			waitFor:  config.WaitFor{Field: "status.refreshTime"},
+			touched:  withStatus("1", 1, map[string]any{"refreshTime": "a"}),
+			current:  withStatus("2", 1, map[string]any{"refreshTime": "a"}),
+			expected: "",
+		},
+		{
+			name:     "observed generation reached",
+			waitFor:  config.WaitFor{ObservedGeneration: true},
+			touched:  withStatus("1", 2, map[string]any{"observedGeneration": int64(1)}),
+			current:  withStatus("2", 2, map[string]any{"observedGeneration": int64(2)}),
+			expected: WaitResultReconciled,
+		},
+		{
+			name:     "observed generation behind",
+			waitFor:  config.WaitFor{ObservedGeneration: true},
+			touched:  withStatus("1", 2, map[string]any{"observedGeneration": int64(1)}),
+			current:  withStatus("2", 2, map[string]any{"observedGeneration": int64(1)}),
+			expected: "",
+		},
+		{
+			name:     "observed generation reached before the touch",
+			waitFor:  config.WaitFor{ObservedGeneration: true},
+			touched:  withStatus("1", 2, map[string]any{"observedGeneration": int64(2), "phase": "Ready"}),
+			current:  withStatus("2", 2, map[string]any{"observedGeneration": int64(2), "phase": "Ready"}),
+			expected: "",
+		},
+		{
+			name:     "observed generation with status written after the touch",
+			waitFor:  config.WaitFor{ObservedGeneration: true},
+			touched:  withStatus("1", 2, map[string]any{"observedGeneration": int64(2), "phase": "Ready"}),
+			current:  withStatus("2", 2, map[string]any{"observedGeneration": int64(2), "phase": "Syncing"}),
+			expected: WaitResultReconciled,
+		},
+		{
+			name:     "resource version",
+			waitFor:  config.WaitFor{ResourceVersion: true},
+			touched:  withStatus("1", 1, nil),
+			current:  withStatus("2", 1, nil),
+			expected: WaitResultReconciled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, msg := checkReconciled(&tt.waitFor, tt.touched, tt.current)
+			assert.Equal(t, tt.expected, result)
+			assert.NotEmpty(t, msg)
+		})
+	}
+}
+
+func TestWaitForReconcile(t *testing.T) {
+	res := configMaps
+	res.WaitFor = &config.WaitFor{Field: "status.refreshTime", Timeout: config.Duration{Duration: time.Second}}
+
+	t.Run("reconciled", func(t *testing.T) {
+		cl := &watchClient{watcher: watch.NewFake()}
+		go func() {
+			cl.watcher.Modify(withStatus("2", 1, map[string]any{"refreshTime": "a"}))
+			cl.watcher.Modify(withStatus("3", 1, map[string]any{"refreshTime": "b"}))
+		}()
+
+		var messages []string
+		ws, err := WaitForReconcile(t.Context(), cl, res, withStatus("1", 1, map[string]any{"refreshTime": "a"}),
+			func(msg string) { messages = append(messages, msg) })
+		require.NoError(t, err)
+		assert.Equal(t, WaitResultReconciled, ws.Result)
+		assert.Equal(t, "3", ws.ResourceVersion)
+		assert.Len(t, messages, 2)
+	})
+
+	t.Run("condition reconciling", func(t *testing.T) {
+		res := res
+		res.WaitFor = &config.WaitFor{
+			Condition: &config.WaitCondition{Type: "Ready", Status: "True"},
+			Timeout:   config.Duration{Duration: time.Second},
+		}
+		cl := &watchClient{watcher: watch.NewFake()}
+		go func() {
+			cl.watcher.Modify(withStatus("2", 1, readyCondition("Unknown", "reconciling")))
+			cl.watcher.Modify(withStatus("3", 1, readyCondition("True", "refreshed")))
+		}()
+
+		ws, err := WaitForReconcile(t.Context(), cl, res, withStatus("1", 1, readyCondition("True", "")), nil)
+		require.NoError(t, err)
+		assert.Equal(t, WaitResultReconciled, ws.Result)
+		assert.Equal(t, "3", ws.ResourceVersion)
+	})
+
+	t.Run("deleted", func(t *testing.T) {
+		cl := &watchClient{watcher: watch.NewFake()}
+		go cl.watcher.Delete(withStatus("2", 1, nil))
+
+		ws, err := WaitForReconcile(t.Context(), cl, res, withStatus("1", 1, nil), nil)
+		require.NoError(t, err)
+		assert.Equal(t, WaitResultFailed, ws.Result)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		res := res
+		res.WaitFor = &config.WaitFor{ResourceVersion: true, Timeout: config.Duration{Duration: 10 * time.Millisecond}}
+		cl := &watchClient{watcher: watch.NewFake()}
+
+		ws, err := WaitForReconcile(t.Context(), cl, res, withStatus("1", 1, nil), nil)
+		require.NoError(t, err)
+		assert.Equal(t, WaitResultTimeout, ws.Result)
+	})
+}
@@ -0,0 +1,183 @@
+package leader
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bakito/argocd-touch-extension/internal/config"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	envPodName      = "POD_NAME"
+	envPodNamespace = "POD_NAMESPACE"
+
+	serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+	defaultNamespace            = "default"
+	// DefaultLeaseName is the name of the lease used if none is configured.
+	DefaultLeaseName = "argocd-touch-extension"
+
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+// Subsystem is a background task that must only run on one replica.
+// The context is canceled when the leadership is lost.
+type Subsystem func(ctx context.Context)
+
+// Status is the leader election state of this replica.
+type Status struct {
+	Enabled bool `json:"enabled"`
+	// Active is true while the replica takes part in the election, which it only does if there are background subsystems.
+	Active    bool   `json:"active"`
+	Lease     string `json:"lease,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Identity  string `json:"identity"`
+	Leader    bool   `json:"leader"`
+	Holder    string `json:"holder,omitempty"`
+}
+
+// Elector runs the background subsystems while this replica holds the lease.
+// All replicas keep serving requests independent of the leadership.
+type Elector struct {
+	enabled   bool
+	lease     string
+	namespace string
+	identity  string
+	elector   atomic.Pointer[leaderelection.LeaderElector]
+	active    atomic.Bool
+	leading   atomic.Bool
+}
+
+// New creates an elector for the given config. Namespace and identity default to the pod the process runs in.
+func New(cfg config.LeaderElection) *Elector {
+	e := &Elector{
+		enabled:   cfg.Enabled,
+		lease:     cfg.LeaseName,
+		namespace: cfg.Namespace,
+		identity:  identity(),
+	}
+	if e.lease == "" {
+		e.lease = DefaultLeaseName
+	}
+	if e.namespace == "" {
+		e.namespace = namespace()
+	}
+	return e
+}
+
+// Run calls the subsystems while being the leader and blocks until the context is done.
+// If leader election is disabled, the subsystems are run right away.
+func (e *Elector) Run(ctx context.Context, subsystems ...Subsystem) error {
+	if len(subsystems) == 0 {
+		return nil
+	}
+	if !e.enabled {
+		e.lead(ctx, subsystems)
+		return nil
+	}
+
+	lock, err := resourcelock.NewFromKubeconfig(
+		resourcelock.LeasesResourceLock,
+		e.namespace,
+		e.lease,
+		resourcelock.ResourceLockConfig{Identity: e.identity},
+		ctrl.GetConfigOrDie(),
+		renewDeadline,
+	)
+	if err != nil {
+		return err
+	}
+	e.active.Store(true)
+	defer e.active.Store(false)
+
+	l := slog.With("lease", e.lease, "namespace", e.namespace, "identity", e.identity)
+	for ctx.Err() == nil {
+		le, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			ReleaseOnCancel: true,
+			LeaseDuration:   leaseDuration,
+			RenewDeadline:   renewDeadline,
+			RetryPeriod:     retryPeriod,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					l.InfoContext(ctx, "Started leading")
+					e.lead(ctx, subsystems)
+				},
+				OnStoppedLeading: func() {
+					l.InfoContext(ctx, "Stopped leading")
+				},
+				OnNewLeader: func(holder string) {
+					l.InfoContext(ctx, "New leader elected", "holder", holder)
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		e.elector.Store(le)
+		le.Run(ctx)
+	}
+	return nil
+}
+
+// lead runs all subsystems until the context is done.
+func (e *Elector) lead(ctx context.Context, subsystems []Subsystem) {
+	e.leading.Store(true)
+	defer e.leading.Store(false)
+
+	var wg sync.WaitGroup
+	for _, s := range subsystems {
+		wg.Go(func() { s(ctx) })
+	}
+	wg.Wait()
+}
+
+// Status returns the current leader election state.
+func (e *Elector) Status() Status {
+	s := Status{
+		Enabled:  e.enabled,
+		Identity: e.identity,
+		Leader:   e.leading.Load(),
+	}
+	if !e.enabled {
+		// every replica runs the subsystems
+		s.Leader = true
+		return s
+	}
+	s.Lease = e.lease
+	s.Namespace = e.namespace
+	s.Active = e.active.Load()
+	if le := e.elector.Load(); le != nil {
+		s.Holder = le.GetLeader()
+	}
+	return s
+}
+
+func identity() string {
+	if name := os.Getenv(envPodName); name != "" {
+		return name
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		return hostname
+	}
+	return "unknown"
+}
+
+func namespace() string {
+	if ns := os.Getenv(envPodNamespace); ns != "" {
+		return ns
+	}
+	if data, err := os.ReadFile(serviceAccountNamespaceFile); err == nil {
+		return strings.TrimSpace(string(data))
+	}
+	return defaultNamespace
+}
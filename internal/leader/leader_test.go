@@ -0,0 +1,58 @@
+package leader
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bakito/argocd-touch-extension/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	t.Setenv(envPodName, "touch-0")
+	t.Setenv(envPodNamespace, "argocd")
+
+	e := New(config.LeaderElection{Enabled: true})
+	assert.Equal(t, Status{
+		Enabled:   true,
+		Lease:     DefaultLeaseName,
+		Namespace: "argocd",
+		Identity:  "touch-0",
+	}, e.Status())
+
+	e = New(config.LeaderElection{Enabled: true, LeaseName: "touch", Namespace: "other"})
+	assert.Equal(t, "touch", e.Status().Lease)
+	assert.Equal(t, "other", e.Status().Namespace)
+}
+
+func TestElector_Run_disabled(t *testing.T) {
+	t.Setenv(envPodName, "touch-0")
+	e := New(config.LeaderElection{})
+
+	assert.Equal(t, Status{Identity: "touch-0", Leader: true}, e.Status())
+
+	ctx, cancel := context.WithCancel(t.Context())
+	started := make(chan struct{}, 2)
+	subsystem := func(ctx context.Context) {
+		assert.True(t, e.leading.Load())
+		started <- struct{}{}
+		<-ctx.Done()
+	}
+
+	done := make(chan error)
+	go func() { done <- e.Run(ctx, subsystem, subsystem) }()
+
+	<-started
+	<-started
+	cancel()
+	require.NoError(t, <-done)
+	assert.False(t, e.leading.Load())
+}
+
+func TestElector_Run_noSubsystems(t *testing.T) {
+	e := New(config.LeaderElection{Enabled: true})
+	require.NoError(t, e.Run(t.Context()))
+	assert.False(t, e.Status().Active, "no election without subsystems")
+	assert.False(t, e.Status().Leader)
+}
@@ -0,0 +1,245 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/bakito/argocd-touch-extension/internal/config"
+	sprig "github.com/go-task/slim-sprig/v3"
+)
+
+const (
+	defaultQueueSize = 100
+	defaultRetries   = 3
+
+	defaultMessage = `{{ if .Success }}✅{{ else }}❌{{ end }} Touch of {{ .Kind }} {{ .Namespace }}/{{ .Name }}` +
+		`{{ with .User }} by {{ . }}{{ end }}{{ with .Application }} (application {{ . }}){{ end }}` +
+		`{{ if .Success }} succeeded{{ else }} failed: {{ .Error }}{{ end }}`
+
+	colorSuccess = "2EB886"
+	colorFailure = "A30200"
+)
+
+var (
+	httpTimeout  = 10 * time.Second
+	retryBackoff = time.Second
+)
+
+// Event describes the outcome of a touch.
+type Event struct {
+	Resource    string    `json:"resource"`
+	Group       string    `json:"group"`
+	Version     string    `json:"version"`
+	Kind        string    `json:"kind"`
+	Namespace   string    `json:"namespace"`
+	Name        string    `json:"name"`
+	User        string    `json:"user,omitempty"`
+	Application string    `json:"application,omitempty"`
+	Project     string    `json:"project,omitempty"`
+	Time        time.Time `json:"time"`
+	Success     bool      `json:"success"`
+	Error       string    `json:"error,omitempty"`
+}
+
+type Notifier interface {
+	// Notify queues the event for the given targets without blocking.
+	Notify(ctx context.Context, targets []string, event Event)
+	// Run delivers queued notifications until the context is done.
+	Run(ctx context.Context)
+}
+
+// target holds its own queue, so a slow or failing endpoint only delays its own notifications.
+type target struct {
+	name    string
+	cfg     config.NotificationTarget
+	url     string
+	headers map[string]string
+	tpl     *template.Template
+	queue   chan Event
+}
+
+type notifier struct {
+	targets map[string]*target
+	retries int
+	client  *http.Client
+}
+
+func New(cfg config.Notifications) (Notifier, error) {
+	n := &notifier{
+		targets: make(map[string]*target),
+		retries: cfg.Retries,
+		client:  &http.Client{Timeout: httpTimeout},
+	}
+	if n.retries <= 0 {
+		n.retries = defaultRetries
+	}
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+
+	for name, tc := range cfg.Targets {
+		t := &target{
+			name:    name,
+			cfg:     tc,
+			url:     os.ExpandEnv(tc.URL),
+			headers: make(map[string]string),
+			queue:   make(chan Event, queueSize),
+		}
+		for k, v := range tc.Headers {
+			t.headers[k] = os.ExpandEnv(v)
+		}
+
+		content := tc.Template
+		if content == "" && tc.Type != config.NotificationTypeWebhook {
+			content = defaultMessage
+		}
+		if content != "" {
+			tpl, err := template.New(name).Funcs(sprig.TxtFuncMap()).Option("missingkey=error").Parse(content)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse template of notification target %q: %w", name, err)
+			}
+			t.tpl = tpl
+		}
+		n.targets[name] = t
+	}
+	return n, nil
+}
+
+func (n *notifier) Notify(ctx context.Context, targets []string, event Event) {
+	ne := config.NotificationEventFailure
+	if event.Success {
+		ne = config.NotificationEventSuccess
+	}
+	for _, name := range targets {
+		t, ok := n.targets[name]
+		if !ok || !t.cfg.Wants(ne) {
+			continue
+		}
+		select {
+		case t.queue <- event:
+		default:
+			slog.WarnContext(ctx, "Notification queue is full, dropping notification", "target", name)
+		}
+	}
+}
+
+func (n *notifier) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, t := range n.targets {
+		wg.Go(func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case event := <-t.queue:
+					n.deliver(ctx, t, event)
+				}
+			}
+		})
+	}
+	wg.Wait()
+}
+
+func (n *notifier) deliver(ctx context.Context, t *target, event Event) {
+	l := slog.With("target", t.name, "type", t.cfg.Type)
+	body, err := t.payload(event)
+	if err != nil {
+		l.ErrorContext(ctx, "Failed to render notification", "error", err)
+		return
+	}
+
+	backoff := retryBackoff
+	for attempt := 0; ; attempt++ {
+		err = n.send(ctx, t, body)
+		if err == nil {
+			l.DebugContext(ctx, "Notification sent")
+			return
+		}
+		if attempt >= n.retries {
+			l.ErrorContext(ctx, "Failed to send notification", "error", err, "attempts", attempt+1)
+			return
+		}
+		l.WarnContext(ctx, "Failed to send notification, retrying", "error", err, "backoff", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (n *notifier) send(ctx context.Context, t *target, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// payload renders the request body for the target type.
+func (t *target) payload(event Event) ([]byte, error) {
+	if t.cfg.Type == config.NotificationTypeWebhook {
+		if t.tpl == nil {
+			return json.Marshal(event)
+		}
+		body, err := t.render(event)
+		if err != nil {
+			return nil, err
+		}
+		if !json.Valid(body) {
+			return nil, errors.New("webhook template did not render valid JSON")
+		}
+		return body, nil
+	}
+
+	msg, err := t.render(event)
+	if err != nil {
+		return nil, err
+	}
+	if t.cfg.Type == config.NotificationTypeSlack {
+		return json.Marshal(map[string]string{"text": string(msg)})
+	}
+
+	color := colorFailure
+	if event.Success {
+		color = colorSuccess
+	}
+	return json.Marshal(map[string]string{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"themeColor": color,
+		"summary":    string(msg),
+		"text":       string(msg),
+	})
+}
+
+func (t *target) render(event Event) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := t.tpl.Execute(&buf, event); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
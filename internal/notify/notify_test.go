@@ -0,0 +1,177 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bakito/argocd-touch-extension/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTargetPayload(t *testing.T) {
+	event := Event{
+		Resource:  "es",
+		Kind:      "ExternalSecret",
+		Namespace: "prod",
+		Name:      "db",
+		User:      "alice",
+		Success:   true,
+	}
+
+	tests := []struct {
+		name     string
+		target   config.NotificationTarget
+		event    Event
+		expected map[string]any
+		wantErr  bool
+	}{
+		{
+			name:   "webhook without template",
+			target: config.NotificationTarget{Type: config.NotificationTypeWebhook},
+			event:  event,
+			expected: map[string]any{
+				"resource": "es", "group": "", "version": "", "kind": "ExternalSecret", "namespace": "prod",
+				"name": "db", "user": "alice", "time": "0001-01-01T00:00:00Z", "success": true,
+			},
+		},
+		{
+			name: "webhook with template",
+			target: config.NotificationTarget{
+				Type:     config.NotificationTypeWebhook,
+				Template: `{"object": {{ printf "%s/%s" .Namespace .Name | toJson }}}`,
+			},
+			event:    event,
+			expected: map[string]any{"object": "prod/db"},
+		},
+		{
+			name: "webhook with invalid json",
+			target: config.NotificationTarget{
+				Type:     config.NotificationTypeWebhook,
+				Template: `{"object": {{ .Name }}}`,
+			},
+			event:   event,
+			wantErr: true,
+		},
+		{
+			name:     "slack",
+			target:   config.NotificationTarget{Type: config.NotificationTypeSlack},
+			event:    event,
+			expected: map[string]any{"text": "✅ Touch of ExternalSecret prod/db by alice succeeded"},
+		},
+		{
+			name:   "teams failure",
+			target: config.NotificationTarget{Type: config.NotificationTypeTeams, Template: "{{ .Error }}"},
+			event:  Event{Error: "forbidden"},
+			expected: map[string]any{
+				"@type":      "MessageCard",
+				"@context":   "https://schema.org/extensions",
+				"themeColor": colorFailure,
+				"summary":    "forbidden",
+				"text":       "forbidden",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := New(config.Notifications{Targets: map[string]config.NotificationTarget{"t": tt.target}})
+			require.NoError(t, err)
+
+			body, err := n.(*notifier).targets["t"].payload(tt.event)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			var actual map[string]any
+			require.NoError(t, json.Unmarshal(body, &actual))
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestNotifierRun(t *testing.T) {
+	retryBackoff = time.Millisecond
+
+	bodies := make(chan string, 10)
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		assert.Equal(t, "secret", r.Header.Get("X-Token"))
+		bodies <- string(b)
+	}))
+	defer srv.Close()
+
+	t.Setenv("TEST_TOKEN", "secret")
+	n, err := New(config.Notifications{Targets: map[string]config.NotificationTarget{
+		"hook": {
+			Type:     config.NotificationTypeWebhook,
+			URL:      srv.URL,
+			Headers:  map[string]string{"X-Token": "${TEST_TOKEN}"},
+			Template: `{"name": {{ .Name | toJson }}}`,
+			Events:   []config.NotificationEvent{config.NotificationEventFailure},
+		},
+	}})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go n.Run(ctx)
+
+	n.Notify(ctx, []string{"hook", "unknown"}, Event{Name: "ignored", Success: true})
+	n.Notify(ctx, []string{"hook"}, Event{Name: "failed"})
+
+	select {
+	case b := <-bodies:
+		assert.JSONEq(t, `{"name": "failed"}`, b)
+	case <-time.After(5 * time.Second):
+		t.Fatal("notification was not delivered")
+	}
+	assert.Equal(t, 2, calls)
+}
+
+func TestNotifierRunIndependentTargets(t *testing.T) {
+	retryBackoff = time.Hour
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	delivered := make(chan struct{}, 1)
+	healthy := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		delivered <- struct{}{}
+	}))
+	defer healthy.Close()
+
+	n, err := New(config.Notifications{Targets: map[string]config.NotificationTarget{
+		"failing": {Type: config.NotificationTypeWebhook, URL: failing.URL},
+		"healthy": {Type: config.NotificationTypeWebhook, URL: healthy.URL},
+	}})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go n.Run(ctx)
+
+	n.Notify(ctx, []string{"failing"}, Event{Name: "first"})
+	n.Notify(ctx, []string{"healthy"}, Event{Name: "second"})
+
+	select {
+	case <-delivered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("notification was blocked by the failing target")
+	}
+}
@@ -0,0 +1,191 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bakito/argocd-touch-extension/internal/config"
+	"github.com/bakito/argocd-touch-extension/internal/k8s"
+	"github.com/bakito/argocd-touch-extension/internal/notify"
+	"github.com/robfig/cron/v3"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const userPrefix = "schedule:"
+
+// now is replaceable in tests.
+var now = time.Now
+
+// JobStatus is the state of a schedule.
+type JobStatus struct {
+	Resource   string     `json:"resource"`
+	Name       string     `json:"name"`
+	Cron       string     `json:"cron"`
+	Selector   string     `json:"selector"`
+	Namespaces []string   `json:"namespaces,omitempty"`
+	Active     bool       `json:"active"`
+	NextRun    time.Time  `json:"nextRun"`
+	LastRun    *time.Time `json:"lastRun,omitempty"`
+	LastResult string     `json:"lastResult,omitempty"`
+}
+
+type job struct {
+	key      string
+	res      config.Resource
+	schedule config.Schedule
+	cron     cron.Schedule
+
+	mu         sync.Mutex
+	lastRun    time.Time
+	lastResult string
+}
+
+// Scheduler touches the objects of the configured schedules.
+type Scheduler struct {
+	client   k8s.Client
+	notifier notify.Notifier
+	touch    k8s.TouchOptions
+	jobs     []*job
+	active   atomic.Bool
+}
+
+func New(
+	cl k8s.Client,
+	notifier notify.Notifier,
+	resources map[string]config.Resource,
+	touch k8s.TouchOptions,
+) (*Scheduler, error) {
+	s := &Scheduler{
+		client:   cl,
+		notifier: notifier,
+		touch:    touch,
+	}
+	for key, res := range resources {
+		for _, sc := range res.Schedules {
+			cs, err := cron.ParseStandard(sc.Cron)
+			if err != nil {
+				return nil, fmt.Errorf("resource %q schedule %q has invalid cron expression: %w", key, sc.Name, err)
+			}
+			if _, err := labels.Parse(sc.Selector); err != nil {
+				return nil, fmt.Errorf("resource %q schedule %q has invalid selector: %w", key, sc.Name, err)
+			}
+			s.jobs = append(s.jobs, &job{key: key, res: res, schedule: sc, cron: cs})
+		}
+	}
+	sort.Slice(s.jobs, func(i, j int) bool {
+		if s.jobs[i].key != s.jobs[j].key {
+			return s.jobs[i].key < s.jobs[j].key
+		}
+		return s.jobs[i].schedule.Name < s.jobs[j].schedule.Name
+	})
+	return s, nil
+}
+
+// Empty returns true if no schedules are configured.
+func (s *Scheduler) Empty() bool {
+	return len(s.jobs) == 0
+}
+
+// Run executes the schedules until the context is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	c := cron.New()
+	for _, j := range s.jobs {
+		c.Schedule(j.cron, cron.FuncJob(func() { s.execute(ctx, j) }))
+	}
+
+	slog.InfoContext(ctx, "Starting scheduler", "schedules", len(s.jobs))
+	c.Start()
+	s.active.Store(true)
+
+	<-ctx.Done()
+
+	s.active.Store(false)
+	<-c.Stop().Done()
+	slog.InfoContext(ctx, "Scheduler stopped")
+}
+
+// Jobs returns the state of all schedules.
+func (s *Scheduler) Jobs() []JobStatus {
+	t := now()
+	status := make([]JobStatus, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		js := JobStatus{
+			Resource:   j.key,
+			Name:       j.schedule.Name,
+			Cron:       j.schedule.Cron,
+			Selector:   j.schedule.Selector,
+			Namespaces: j.schedule.Namespaces,
+			Active:     s.active.Load(),
+			NextRun:    j.cron.Next(t),
+		}
+		j.mu.Lock()
+		if !j.lastRun.IsZero() {
+			lastRun := j.lastRun
+			js.LastRun = &lastRun
+			js.LastResult = j.lastResult
+		}
+		j.mu.Unlock()
+		status = append(status, js)
+	}
+	return status
+}
+
+// execute touches all objects matching the schedule.
+func (s *Scheduler) execute(ctx context.Context, j *job) {
+	l := slog.With("resource", j.key, "schedule", j.schedule.Name, "dryRun", s.touch.DryRun)
+	start := now()
+	user := userPrefix + j.schedule.Name
+
+	namespaces := j.schedule.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+
+	var touched, failed int
+	for _, ns := range namespaces {
+		items, err := s.client.List(ctx, j.res, ns, j.schedule.Selector)
+		if err != nil {
+			l.ErrorContext(ctx, "Failed to list objects", "namespace", ns, "error", err)
+			failed++
+			continue
+		}
+		for _, item := range items {
+			event := notify.Event{
+				Resource:  j.key,
+				Group:     j.res.Group,
+				Version:   j.res.Version,
+				Kind:      j.res.Kind,
+				Namespace: item.GetNamespace(),
+				Name:      item.GetName(),
+				User:      user,
+				Time:      now(),
+			}
+			_, err := k8s.Touch(ctx, s.client, j.res, item.GetNamespace(), item.GetName(), user, s.touch)
+			if err != nil {
+				l.With("namespace", item.GetNamespace(), "name", item.GetName()).
+					ErrorContext(ctx, "Failed to touch object", "error", err)
+				failed++
+				event.Error = err.Error()
+			} else {
+				touched++
+				event.Success = true
+			}
+			if !s.touch.DryRun {
+				s.notifier.Notify(ctx, j.res.Notify, event)
+			}
+		}
+	}
+
+	result := fmt.Sprintf("%d touched, %d failed", touched, failed)
+	l.With("touched", touched, "failed", failed, "duration", now().Sub(start)).InfoContext(ctx, "Schedule executed")
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.lastRun = start
+	j.lastResult = result
+}
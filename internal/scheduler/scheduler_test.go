@@ -0,0 +1,168 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bakito/argocd-touch-extension/internal/config"
+	"github.com/bakito/argocd-touch-extension/internal/k8s"
+	"github.com/bakito/argocd-touch-extension/internal/notify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// listClient is a k8s.Client listing the configured objects per namespace.
+type listClient struct {
+	k8s.Client
+	objects map[string][]string
+	failing string
+	patched []string
+}
+
+func (l *listClient) List(_ context.Context, _ config.Resource, namespace, _ string) ([]unstructured.Unstructured, error) {
+	if namespace == l.failing {
+		return nil, errors.New("forbidden")
+	}
+	var items []unstructured.Unstructured
+	for ns, names := range l.objects {
+		if namespace != "" && ns != namespace {
+			continue
+		}
+		for _, name := range names {
+			obj := unstructured.Unstructured{Object: map[string]any{}}
+			obj.SetNamespace(ns)
+			obj.SetName(name)
+			items = append(items, obj)
+		}
+	}
+	return items, nil
+}
+
+func (l *listClient) PatchAnnotations(
+	_ context.Context,
+	_ config.Resource,
+	namespace, name string,
+	_ map[string]string,
+	_ string,
+	_ bool,
+) (*unstructured.Unstructured, error) {
+	l.patched = append(l.patched, namespace+"/"+name)
+	return &unstructured.Unstructured{Object: map[string]any{}}, nil
+}
+
+type recordingNotifier struct {
+	events []notify.Event
+}
+
+func (r *recordingNotifier) Notify(_ context.Context, _ []string, event notify.Event) {
+	r.events = append(r.events, event)
+}
+
+func (*recordingNotifier) Run(context.Context) {}
+
+func TestNew(t *testing.T) {
+	_, err := New(nil, nil, map[string]config.Resource{
+		"cm": {Schedules: []config.Schedule{{Name: "nightly", Cron: "not a cron", Selector: "a=b"}}},
+	}, k8s.TouchOptions{})
+	require.Error(t, err)
+
+	_, err = New(nil, nil, map[string]config.Resource{
+		"cm": {Schedules: []config.Schedule{{Name: "nightly", Cron: "@daily", Selector: "a in (b"}}},
+	}, k8s.TouchOptions{})
+	require.Error(t, err)
+
+	s, err := New(nil, nil, map[string]config.Resource{"cm": {}}, k8s.TouchOptions{})
+	require.NoError(t, err)
+	assert.True(t, s.Empty())
+}
+
+func TestScheduler_Jobs(t *testing.T) {
+	now = func() time.Time { return time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	s, err := New(nil, nil, map[string]config.Resource{
+		"es": {Schedules: []config.Schedule{{Name: "nightly", Cron: "0 2 * * *", Selector: "refresh=nightly"}}},
+		"cm": {Schedules: []config.Schedule{
+			{Name: "weekly", Cron: "@weekly", Selector: "refresh=weekly"},
+			{Name: "hourly", Cron: "@hourly", Selector: "refresh=hourly", Namespaces: []string{"a"}},
+		}},
+	}, k8s.TouchOptions{})
+	require.NoError(t, err)
+
+	jobs := s.Jobs()
+	require.Len(t, jobs, 3)
+	assert.Equal(t, "cm", jobs[0].Resource)
+	assert.Equal(t, "hourly", jobs[0].Name)
+	assert.Equal(t, []string{"a"}, jobs[0].Namespaces)
+	assert.Equal(t, time.Date(2025, 1, 2, 4, 0, 0, 0, time.UTC), jobs[0].NextRun)
+	assert.Equal(t, "weekly", jobs[1].Name)
+	assert.Equal(t, time.Date(2025, 1, 5, 0, 0, 0, 0, time.UTC), jobs[1].NextRun)
+	assert.Equal(t, "es", jobs[2].Resource)
+	assert.Equal(t, time.Date(2025, 1, 3, 2, 0, 0, 0, time.UTC), jobs[2].NextRun)
+	assert.False(t, jobs[2].Active)
+	assert.Nil(t, jobs[2].LastRun)
+}
+
+func TestScheduler_execute(t *testing.T) {
+	tests := []struct {
+		name       string
+		namespaces []string
+		dryRun     bool
+		patched    []string
+		result     string
+		notified   int
+	}{
+		{
+			name:       "restricted namespaces",
+			namespaces: []string{"a", "denied"},
+			patched:    []string{"a/one", "a/two"},
+			result:     "2 touched, 1 failed",
+			notified:   2,
+		},
+		{
+			name:     "all namespaces",
+			patched:  []string{"a/one", "a/two", "b/three"},
+			result:   "3 touched, 0 failed",
+			notified: 3,
+		},
+		{
+			name:       "dry run",
+			namespaces: []string{"b"},
+			dryRun:     true,
+			patched:    []string{"b/three"},
+			result:     "1 touched, 0 failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := &listClient{
+				objects: map[string][]string{"a": {"one", "two"}, "b": {"three"}},
+				failing: "denied",
+			}
+			notifier := &recordingNotifier{}
+			s, err := New(cl, notifier, map[string]config.Resource{
+				"cm": {Schedules: []config.Schedule{
+					{Name: "nightly", Cron: "@daily", Selector: "refresh=nightly", Namespaces: tt.namespaces},
+				}},
+			}, k8s.TouchOptions{DryRun: tt.dryRun})
+			require.NoError(t, err)
+
+			s.execute(t.Context(), s.jobs[0])
+
+			assert.ElementsMatch(t, tt.patched, cl.patched)
+			require.Len(t, notifier.events, tt.notified)
+			for _, e := range notifier.events {
+				assert.True(t, e.Success)
+				assert.Equal(t, "schedule:nightly", e.User)
+			}
+
+			jobs := s.Jobs()
+			require.NotNil(t, jobs[0].LastRun)
+			assert.Equal(t, tt.result, jobs[0].LastResult)
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"net/url"
+	"strings"
+
+	"github.com/bakito/argocd-touch-extension/internal/config"
+	"github.com/bakito/argocd-touch-extension/internal/extension"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	PathMetrics = "/metrics"
+	PathConfig  = "/config"
+	pathPprof   = "/debug/pprof/"
+
+	redacted = "<redacted>"
+)
+
+// adminRouter serves the internal endpoints, which must not be reachable through the Argo CD proxy.
+func adminRouter(ext extension.Extension, opts Options, health func(r gin.IRoutes)) *gin.Engine {
+	router := gin.New()
+	router.Use(recovery())
+	health(router)
+	router.GET(PathMetrics, metricsHandler())
+	router.GET(PathConfig, handleConfigDump(ext, opts))
+	router.GET(pathPprof+"*profile", handlePprof())
+	return router
+}
+
+func handlePprof() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch strings.TrimPrefix(c.Param("profile"), "/") {
+		case "cmdline":
+			pprof.Cmdline(c.Writer, c.Request)
+		case "profile":
+			pprof.Profile(c.Writer, c.Request)
+		case "symbol":
+			pprof.Symbol(c.Writer, c.Request)
+		case "trace":
+			pprof.Trace(c.Writer, c.Request)
+		default:
+			// the index serves the named profiles like heap or goroutine
+			pprof.Index(c.Writer, c.Request)
+		}
+	}
+}
+
+// ConfigDump is the effective configuration, secrets of the notification targets are redacted.
+type ConfigDump struct {
+	ServiceAddress string                               `json:"serviceAddress"`
+	DryRun         bool                                 `json:"dryRun"`
+	RateLimit      config.RateLimit                     `json:"rateLimit"`
+	Retry          config.Retry                         `json:"retry"`
+	LeaderElection config.LeaderElection                `json:"leaderElection"`
+	Server         config.Server                        `json:"server"`
+	Resources      map[string]config.Resource           `json:"resources"`
+	Notifications  map[string]config.NotificationTarget `json:"notifications,omitempty"`
+}
+
+func handleConfigDump(ext extension.Extension, opts Options) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dump := ConfigDump{
+			ServiceAddress: opts.Config.ServiceAddress,
+			DryRun:         opts.Config.DryRun,
+			RateLimit:      opts.Config.RateLimit,
+			Retry:          opts.Config.Retry,
+			LeaderElection: opts.Config.LeaderElection,
+			Server:         opts.Config.Server,
+			Resources:      ext.Resources(),
+		}
+		for name, target := range opts.Config.Notifications.Targets {
+			if dump.Notifications == nil {
+				dump.Notifications = make(map[string]config.NotificationTarget)
+			}
+			dump.Notifications[name] = redactTarget(target)
+		}
+		c.JSON(http.StatusOK, dump)
+	}
+}
+
+// redactTarget removes credentials from the target, webhook URLs often contain a token in the path.
+func redactTarget(target config.NotificationTarget) config.NotificationTarget {
+	if u, err := url.Parse(target.URL); err == nil && u.Host != "" {
+		target.URL = u.Scheme + "://" + u.Host + "/" + redacted
+	} else {
+		target.URL = redacted
+	}
+	if len(target.Headers) > 0 {
+		headers := make(map[string]string, len(target.Headers))
+		for k := range target.Headers {
+			headers[k] = redacted
+		}
+		target.Headers = headers
+	}
+	return target
+}
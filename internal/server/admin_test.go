@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bakito/argocd-touch-extension/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newAdminRouter(opts Options) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	ext := &fakeExtension{
+		resources: map[string]config.Resource{"cm": {Version: "v1", Kind: "ConfigMap", Name: "configmaps"}},
+		js:        []byte("js"),
+	}
+	return adminRouter(ext, opts, func(r gin.IRoutes) {
+		r.GET(PathHealthz, handleHealthz())
+	})
+}
+
+func TestAdminRouter(t *testing.T) {
+	router := newAdminRouter(Options{})
+
+	for _, path := range []string{PathHealthz, pathPprof, pathPprof + "goroutine?debug=1", pathPprof + "cmdline"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, http.NoBody))
+		assert.Equal(t, http.StatusOK, rec.Code, path)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	public := gin.New()
+	public.Use(metrics())
+	public.GET("/v1/touch/cm/:namespace/:name", func(c *gin.Context) {
+		touchesTotal.WithLabelValues("cm", touchResult(nil), "false").Inc()
+		c.Status(http.StatusOK)
+	})
+	public.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/touch/cm/default/test", http.NoBody))
+
+	rec := httptest.NewRecorder()
+	newAdminRouter(Options{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, PathMetrics, http.NoBody))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	assert.Contains(t, body,
+		`argocd_touch_extension_http_requests_total{code="200",method="GET",route="/v1/touch/cm/:namespace/:name"}`)
+	assert.Contains(t, body, `argocd_touch_extension_touches_total{dry_run="false",resource="cm",result="success"}`)
+	assert.Contains(t, body, "go_goroutines")
+}
+
+func TestHandleConfigDump(t *testing.T) {
+	router := newAdminRouter(Options{Config: config.TouchConfig{
+		ServiceAddress: "https://touch:8080",
+		DryRun:         true,
+		LeaderElection: config.LeaderElection{Enabled: true, LeaseName: "touch"},
+		Notifications: config.Notifications{Targets: map[string]config.NotificationTarget{
+			"slack": {Type: config.NotificationTypeSlack, URL: "https://hooks.slack.com/services/T0/B0/secret"},
+			"hook": {
+				Type:    config.NotificationTypeWebhook,
+				URL:     "${WEBHOOK_URL}",
+				Headers: map[string]string{"Authorization": "Bearer secret"},
+			},
+		}},
+	}})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, PathConfig, http.NoBody))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "secret")
+
+	var dump ConfigDump
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &dump))
+	assert.Equal(t, "https://touch:8080", dump.ServiceAddress)
+	assert.True(t, dump.DryRun)
+	assert.Equal(t, config.LeaderElection{Enabled: true, LeaseName: "touch"}, dump.LeaderElection)
+	assert.Contains(t, rec.Body.String(), `"leaderElection":{"enabled":true,"leaseName":"touch"}`)
+	assert.Equal(t, "configmaps", dump.Resources["cm"].Name)
+	assert.Equal(t, "https://hooks.slack.com/<redacted>", dump.Notifications["slack"].URL)
+	assert.Equal(t, "<redacted>", dump.Notifications["hook"].URL)
+	assert.Equal(t, map[string]string{"Authorization": "<redacted>"}, dump.Notifications["hook"].Headers)
+}
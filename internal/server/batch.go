@@ -0,0 +1,205 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"sync"
+
+	"github.com/bakito/argocd-touch-extension/internal/config"
+	"github.com/bakito/argocd-touch-extension/internal/k8s"
+	"github.com/bakito/argocd-touch-extension/internal/notify"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	apiPathBatch  = "/batch"
+	maxBatchItems = 100
+
+	BatchStatusAll     BatchStatus = "all"
+	BatchStatusPartial BatchStatus = "partial"
+	BatchStatusNone    BatchStatus = "none"
+)
+
+// batchConcurrency is the max number of objects touched in parallel per batch.
+var batchConcurrency = 5
+
+// BatchStatus tells how many items of a batch were touched.
+type BatchStatus string
+
+// BatchRequest lists the objects to touch.
+type BatchRequest struct {
+	Items []BatchItem `json:"items"`
+}
+
+// BatchItem is an object to touch, the resource key defaults to the extension of the request.
+type BatchItem struct {
+	ResourceKey string `json:"resourceKey,omitempty"`
+	Namespace   string `json:"namespace"`
+	Name        string `json:"name"`
+}
+
+// BatchItemResult is the outcome of touching a single item.
+type BatchItemResult struct {
+	BatchItem
+	Status int `json:"status"`
+	// Attempts is the number of patch attempts, 0 if the item was rejected before patching.
+	Attempts        int            `json:"attempts"`
+	ResourceVersion string         `json:"resourceVersion,omitempty"`
+	Error           *ErrorResponse `json:"error,omitempty"`
+}
+
+// BatchResponse is returned after touching a batch of objects.
+type BatchResponse struct {
+	Status    BatchStatus       `json:"status"`
+	DryRun    bool              `json:"dryRun"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Items     []BatchItemResult `json:"items"`
+}
+
+// batch touches objects of the resources with bounded concurrency.
+type batch struct {
+	client    k8s.Client
+	notifier  notify.Notifier
+	resources map[string]config.Resource
+	limits    *userLimits
+	cooldown  *cooldown
+	retry     config.Retry
+}
+
+func handleBatch(
+	cl k8s.Client,
+	notifier notify.Notifier,
+	resources map[string]config.Resource,
+	limits *userLimits,
+	cd *cooldown,
+	retry config.Retry,
+) gin.HandlerFunc {
+	b := &batch{client: cl, notifier: notifier, resources: resources, limits: limits, cooldown: cd, retry: retry}
+	return func(c *gin.Context) {
+		var req BatchRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			abortWithError(c, http.StatusBadRequest, ErrorCodeInvalidParameter, "Invalid batch request: "+err.Error(), nil)
+			return
+		}
+		if len(req.Items) == 0 || len(req.Items) > maxBatchItems {
+			abortWithError(c, http.StatusBadRequest, ErrorCodeInvalidParameter,
+				fmt.Sprintf("A batch requires 1 to %d items", maxBatchItems), gin.H{"items": len(req.Items)})
+			return
+		}
+
+		dryRun := c.GetBool(contextKeyDryRun)
+		extName := c.GetHeader(headerArgocdExtensionName)
+		user := c.GetHeader(headerArgoCDUsername)
+
+		resp := BatchResponse{DryRun: dryRun, Items: make([]BatchItemResult, len(req.Items))}
+		sem := make(chan struct{}, batchConcurrency)
+		var wg sync.WaitGroup
+		for i, item := range req.Items {
+			if item.ResourceKey == "" {
+				item.ResourceKey = extName
+			}
+			sem <- struct{}{}
+			wg.Go(func() {
+				defer func() { <-sem }()
+				resp.Items[i] = b.touch(c, item, extName, user, dryRun)
+			})
+		}
+		wg.Wait()
+
+		for _, r := range resp.Items {
+			if r.Error == nil {
+				resp.Succeeded++
+			} else {
+				resp.Failed++
+			}
+		}
+		switch {
+		case resp.Failed == 0:
+			resp.Status = BatchStatusAll
+		case resp.Succeeded == 0:
+			resp.Status = BatchStatusNone
+		default:
+			resp.Status = BatchStatusPartial
+		}
+		slog.With(
+			"extension", extName,
+			"user", user,
+			"dryRun", dryRun,
+			"succeeded", resp.Succeeded,
+			"failed", resp.Failed,
+			"requestId", c.GetString(contextKeyRequestID),
+		).InfoContext(c, "Batch touched")
+
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// touch touches a single item, items of other resources than the extension are rejected,
+// as Argo CD authorizes the request for the extension only.
+func (b *batch) touch(c *gin.Context, item BatchItem, extName, user string, dryRun bool) BatchItemResult {
+	result := BatchItemResult{BatchItem: item}
+	fail := func(status int, code ErrorCode, msg string) BatchItemResult {
+		result.Status = status
+		result.Error = &ErrorResponse{Code: code, Message: msg}
+		return result
+	}
+
+	if item.Namespace == "" || item.Name == "" {
+		return fail(http.StatusBadRequest, ErrorCodeInvalidParameter, "Namespace and name are required")
+	}
+	if item.ResourceKey != extName {
+		return fail(http.StatusBadRequest, ErrorCodeInvalidExtensionName,
+			fmt.Sprintf("Resource %q can not be touched through extension %q", item.ResourceKey, extName))
+	}
+	res, ok := b.resources[item.ResourceKey]
+	if !ok {
+		return fail(http.StatusNotFound, ErrorCodeNotFound, "Unknown resource: "+item.ResourceKey)
+	}
+
+	// every item takes a token of the user, as if it was touched on its own
+	if b.limits != nil && !dryRun {
+		if retryAfter, ok := b.limits.reserve(limiterKey(c)); !ok {
+			return fail(http.StatusTooManyRequests, ErrorCodeRateLimited,
+				fmt.Sprintf("Rate limit exceeded, retry in %ds", int(math.Ceil(retryAfter.Seconds()))))
+		}
+	}
+
+	objectKey := item.ResourceKey + "/" + item.Namespace + "/" + item.Name
+	if res.Cooldown.Duration > 0 && !dryRun {
+		if retryAfter, ok := b.cooldown.reserve(objectKey, res.Cooldown.Duration); !ok {
+			return fail(http.StatusTooManyRequests, ErrorCodeCooldown,
+				fmt.Sprintf("Object was touched recently, retry in %ds", int(math.Ceil(retryAfter.Seconds()))))
+		}
+	}
+
+	l := slog.With(
+		"resource", res.Name,
+		"namespace", item.Namespace,
+		"name", item.Name,
+		"dryRun", dryRun,
+		"requestId", c.GetString(contextKeyRequestID),
+	)
+	if user != "" {
+		l = l.With("user", user)
+	}
+
+	event := touchEvent(c, item.ResourceKey, res, item.Namespace, item.Name, user)
+	opts := k8s.TouchOptions{DryRun: dryRun, Retry: b.retry}
+	touched, err := touchObject(c.Request.Context(), b.client, b.notifier, l, item.ResourceKey, res, event, opts)
+	result.Attempts = touched.Attempts
+	if err != nil {
+		if res.Cooldown.Duration > 0 && !dryRun {
+			b.cooldown.release(objectKey)
+		}
+		status, e := kubernetesError(err)
+		result.Status = status
+		result.Error = &e
+		return result
+	}
+	result.Status = http.StatusOK
+	result.ResourceVersion = touched.Object.GetResourceVersion()
+	return result
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bakito/argocd-touch-extension/internal/config"
+	"github.com/bakito/argocd-touch-extension/internal/k8s"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleBatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// sequential to get a deterministic cooldown of duplicate items
+	batchConcurrency = 1
+	defer func() { batchConcurrency = 5 }()
+	resources := map[string]config.Resource{
+		"cm": {Version: "v1", Kind: "ConfigMap", Name: "configmaps", Cooldown: config.Duration{Duration: time.Minute}},
+		"sa": {Version: "v1", Kind: "ServiceAccount", Name: "serviceaccounts"},
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		dryRun   bool
+		limits   config.RateLimit
+		code     int
+		status   BatchStatus
+		results  []int
+		notified int
+	}{
+		{
+			name:     "all",
+			body:     `{"items":[{"namespace":"a","name":"one"},{"resourceKey":"cm","namespace":"a","name":"two"}]}`,
+			code:     http.StatusOK,
+			status:   BatchStatusAll,
+			results:  []int{http.StatusOK, http.StatusOK},
+			notified: 2,
+		},
+		{
+			name: "partial",
+			body: `{"items":[{"namespace":"a","name":"one"},{"namespace":"a","name":"missing"},` +
+				`{"resourceKey":"sa","namespace":"a","name":"one"},{"namespace":"a","name":"one"},{"namespace":"a"}]}`,
+			code:   http.StatusOK,
+			status: BatchStatusPartial,
+			results: []int{
+				http.StatusOK,
+				http.StatusNotFound,
+				http.StatusBadRequest,
+				http.StatusTooManyRequests,
+				http.StatusBadRequest,
+			},
+			notified: 2,
+		},
+		{
+			name:    "none",
+			body:    `{"items":[{"namespace":"a","name":"missing"}]}`,
+			code:    http.StatusOK,
+			status:  BatchStatusNone,
+			results: []int{http.StatusNotFound},
+			// failures are notified as well
+			notified: 1,
+		},
+		{
+			name:    "dry run ignores cooldown",
+			body:    `{"items":[{"namespace":"a","name":"one"},{"namespace":"a","name":"one"}]}`,
+			dryRun:  true,
+			code:    http.StatusOK,
+			status:  BatchStatusAll,
+			results: []int{http.StatusOK, http.StatusOK},
+		},
+		{
+			name: "user limit per item",
+			body: `{"items":[{"namespace":"a","name":"one"},{"namespace":"a","name":"two"},` +
+				`{"namespace":"a","name":"missing"}]}`,
+			limits:   config.RateLimit{UserPerMinute: 1, UserBurst: 2},
+			code:     http.StatusOK,
+			status:   BatchStatusPartial,
+			results:  []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+			notified: 2,
+		},
+		{
+			name:    "dry run ignores user limit",
+			body:    `{"items":[{"namespace":"a","name":"one"},{"namespace":"a","name":"two"}]}`,
+			dryRun:  true,
+			limits:  config.RateLimit{UserPerMinute: 1},
+			code:    http.StatusOK,
+			status:  BatchStatusAll,
+			results: []int{http.StatusOK, http.StatusOK},
+		},
+		{name: "empty", body: `{"items":[]}`, code: http.StatusBadRequest},
+		{name: "invalid body", body: `{"items":`, code: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := newFakeClient(newObject("a", "one", nil), newObject("a", "two", nil))
+			notifier := &fakeNotifier{}
+			router := gin.New()
+			router.POST("/v1/touch/batch", parseDryRun(tt.dryRun),
+				handleBatch(cl, notifier, resources, newUserLimits(tt.limits), newCooldown(), config.Retry{}))
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/touch/batch", bytes.NewBufferString(tt.body))
+			req.Header.Set(headerArgocdExtensionName, "cm")
+			req.Header.Set(headerArgoCDUsername, "alice")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.code, rec.Code, rec.Body.String())
+			if tt.code != http.StatusOK {
+				return
+			}
+			var resp BatchResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, tt.status, resp.Status)
+			assert.Equal(t, tt.dryRun, resp.DryRun)
+			statuses := make([]int, 0, len(resp.Items))
+			for _, item := range resp.Items {
+				statuses = append(statuses, item.Status)
+				if item.Status == http.StatusOK {
+					assert.Nil(t, item.Error)
+					assert.Equal(t, "cm", item.ResourceKey)
+					assert.Equal(t, 1, item.Attempts)
+				} else {
+					assert.NotNil(t, item.Error)
+				}
+			}
+			assert.Equal(t, tt.results, statuses)
+			assert.Len(t, notifier.events, tt.notified)
+
+			obj, err := cl.Get(t.Context(), resources["cm"], "a", "one")
+			require.NoError(t, err)
+			_, touched := obj.GetAnnotations()[k8s.AnnotationTouch]
+			assert.Equal(t, !tt.dryRun && tt.status != BatchStatusNone, touched)
+		})
+	}
+}
+
+func TestValidateArgocdHeaders_batch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/v1/touch/batch", validateArgocdHeaders(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/touch/batch", http.NoBody)
+	req.Header.Set(headerArgocdAppName, "argocd:app")
+	req.Header.Set(headerArgocdProjName, "default")
+	req.Header.Set(headerArgocdExtensionName, "cm")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
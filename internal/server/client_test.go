@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"sync"
+
+	"github.com/bakito/argocd-touch-extension/internal/config"
+	"github.com/bakito/argocd-touch-extension/internal/notify"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// fakeClient is a k8s.Client keeping objects by namespace/name.
+type fakeClient struct {
+	mu       sync.Mutex
+	objects  map[string]*unstructured.Unstructured
+	err      error
+	watchErr error
+	watcher  *watch.FakeWatcher
+}
+
+func newFakeClient(objects ...*unstructured.Unstructured) *fakeClient {
+	fc := &fakeClient{objects: make(map[string]*unstructured.Unstructured), watcher: watch.NewFake()}
+	for _, o := range objects {
+		fc.objects[o.GetNamespace()+"/"+o.GetName()] = o
+	}
+	return fc
+}
+
+func (f *fakeClient) Get(_ context.Context, res config.Resource, namespace, name string) (*unstructured.Unstructured, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.get(res, namespace, name)
+}
+
+func (f *fakeClient) get(res config.Resource, namespace, name string) (*unstructured.Unstructured, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	obj, ok := f.objects[namespace+"/"+name]
+	if !ok {
+		return nil, kerr.NewNotFound(schema.GroupResource{Group: res.Group, Resource: res.Name}, name)
+	}
+	return obj.DeepCopy(), nil
+}
+
+func (f *fakeClient) List(
+	_ context.Context,
+	_ config.Resource,
+	namespace, _ string,
+) ([]unstructured.Unstructured, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	var items []unstructured.Unstructured
+	for _, obj := range f.objects {
+		if namespace == "" || obj.GetNamespace() == namespace {
+			items = append(items, *obj.DeepCopy())
+		}
+	}
+	return items, nil
+}
+
+func (f *fakeClient) PatchAnnotations(
+	_ context.Context,
+	res config.Resource,
+	namespace, name string,
+	annotations map[string]string,
+	resourceVersion string,
+	dryRun bool,
+) (*unstructured.Unstructured, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	obj, err := f.get(res, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	if resourceVersion != "" && resourceVersion != obj.GetResourceVersion() {
+		return nil, kerr.NewConflict(schema.GroupResource{Resource: res.Name}, name, errors.New("object was modified"))
+	}
+	a := obj.GetAnnotations()
+	if a == nil {
+		a = make(map[string]string)
+	}
+	maps.Copy(a, annotations)
+	obj.SetAnnotations(a)
+	if !dryRun {
+		f.objects[namespace+"/"+name] = obj
+	}
+	return obj, nil
+}
+
+func (*fakeClient) SetNameAndVersion(resources map[string]config.Resource) (map[string]config.Resource, error) {
+	return resources, nil
+}
+
+func newObject(namespace, name string, annotations map[string]string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]any{"apiVersion": "v1", "kind": "ConfigMap"}}
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	obj.SetAnnotations(annotations)
+	return obj
+}
+
+func (f *fakeClient) Watch(_ context.Context, _ config.Resource, _, _, _ string) (watch.Interface, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if f.watchErr != nil {
+		return nil, f.watchErr
+	}
+	return f.watcher, nil
+}
+
+func (f *fakeClient) Ping(context.Context) error {
+	return f.err
+}
+
+// fakeNotifier records the notified events.
+type fakeNotifier struct {
+	mu     sync.Mutex
+	events []notify.Event
+}
+
+func (f *fakeNotifier) Notify(_ context.Context, _ []string, event notify.Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, event)
+}
+
+func (*fakeNotifier) Run(context.Context) {}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	headerRequestID     = "X-Request-Id"
+	contextKeyRequestID = "requestID"
+)
+
+// ErrorCode identifies the kind of error independent of the message.
+type ErrorCode string
+
+// Error catalogue.
+const (
+	ErrorCodeMissingHeader             ErrorCode = "MissingHeader"
+	ErrorCodeInvalidExtensionName      ErrorCode = "InvalidExtensionName"
+	ErrorCodeInvalidParameter          ErrorCode = "InvalidParameter"
+	ErrorCodeClientCertificateRequired ErrorCode = "ClientCertificateRequired"
+	ErrorCodeRateLimited               ErrorCode = "RateLimited"
+	ErrorCodeCooldown                  ErrorCode = "Cooldown"
+	ErrorCodeNotFound                  ErrorCode = "NotFound"
+	ErrorCodeForbidden                 ErrorCode = "Forbidden"
+	ErrorCodeConflict                  ErrorCode = "Conflict"
+	ErrorCodeInvalid                   ErrorCode = "Invalid"
+	ErrorCodeKubernetes                ErrorCode = "KubernetesError"
+	ErrorCodeInternal                  ErrorCode = "InternalError"
+)
+
+// errorCodes lists the catalogue for the OpenAPI document.
+var errorCodes = []ErrorCode{
+	ErrorCodeMissingHeader,
+	ErrorCodeInvalidExtensionName,
+	ErrorCodeInvalidParameter,
+	ErrorCodeClientCertificateRequired,
+	ErrorCodeRateLimited,
+	ErrorCodeCooldown,
+	ErrorCodeNotFound,
+	ErrorCodeForbidden,
+	ErrorCodeConflict,
+	ErrorCodeInvalid,
+	ErrorCodeKubernetes,
+	ErrorCodeInternal,
+}
+
+// ErrorResponse is the body of all error responses.
+type ErrorResponse struct {
+	Code      ErrorCode `json:"code"`
+	Message   string    `json:"message"`
+	Reason    string    `json:"reason,omitempty"`
+	Details   any       `json:"details,omitempty"`
+	RequestID string    `json:"requestId,omitempty"`
+}
+
+// abortWithError responds with an error body and stops the handler chain.
+func abortWithError(c *gin.Context, status int, code ErrorCode, message string, details any) {
+	c.AbortWithStatusJSON(status, ErrorResponse{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: c.GetString(contextKeyRequestID),
+	})
+}
+
+// abortWithKubernetesError maps an error of the kubernetes API to an error response.
+func abortWithKubernetesError(c *gin.Context, err error) {
+	status, resp := kubernetesError(err)
+	resp.RequestID = c.GetString(contextKeyRequestID)
+	c.AbortWithStatusJSON(status, resp)
+}
+
+// kubernetesError returns the HTTP status and error body of an error of the kubernetes API.
+func kubernetesError(err error) (int, ErrorResponse) {
+	var se kerr.APIStatus
+	if !errors.As(err, &se) {
+		return http.StatusInternalServerError, ErrorResponse{Code: ErrorCodeInternal, Message: err.Error()}
+	}
+
+	status := se.Status()
+	code := ErrorCodeKubernetes
+	switch status.Reason {
+	case metav1.StatusReasonNotFound:
+		code = ErrorCodeNotFound
+	case metav1.StatusReasonForbidden:
+		code = ErrorCodeForbidden
+	case metav1.StatusReasonConflict, metav1.StatusReasonAlreadyExists:
+		code = ErrorCodeConflict
+	case metav1.StatusReasonInvalid:
+		code = ErrorCodeInvalid
+	default:
+	}
+
+	httpStatus := int(status.Code)
+	if httpStatus == 0 {
+		httpStatus = http.StatusInternalServerError
+	}
+
+	var details any
+	if status.Details != nil {
+		details = status.Details
+	}
+
+	return httpStatus, ErrorResponse{
+		Code:    code,
+		Message: status.Message,
+		Reason:  string(status.Reason),
+		Details: details,
+	}
+}
+
+// requestID takes the request ID from the request header or generates a new one.
+func requestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(headerRequestID)
+		if id == "" {
+			id = uuid.NewString()
+		}
+		c.Set(contextKeyRequestID, id)
+		c.Header(headerRequestID, id)
+		c.Next()
+	}
+}
+
+// recovery responds with a generic error body if a handler panics. The panic value is only logged,
+// as it may expose internal state to the client.
+func recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(nil, func(c *gin.Context, err any) {
+		slog.ErrorContext(c, "Recovered from panic",
+			"error", err,
+			"stack", string(debug.Stack()),
+			"requestId", c.GetString(contextKeyRequestID),
+		)
+		abortWithError(c, http.StatusInternalServerError, ErrorCodeInternal, "Internal server error", nil)
+	})
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestAbortWithKubernetesError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	gr := schema.GroupResource{Resource: "configmaps"}
+
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+		expectedCode   ErrorCode
+		expectedReason string
+	}{
+		{
+			name:           "not found",
+			err:            kerr.NewNotFound(gr, "test"),
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   ErrorCodeNotFound,
+			expectedReason: "NotFound",
+		},
+		{
+			name:           "forbidden",
+			err:            kerr.NewForbidden(gr, "test", errors.New("denied")),
+			expectedStatus: http.StatusForbidden,
+			expectedCode:   ErrorCodeForbidden,
+			expectedReason: "Forbidden",
+		},
+		{
+			name:           "conflict",
+			err:            kerr.NewConflict(gr, "test", errors.New("modified")),
+			expectedStatus: http.StatusConflict,
+			expectedCode:   ErrorCodeConflict,
+			expectedReason: "Conflict",
+		},
+		{
+			name: "invalid",
+			err: kerr.NewInvalid(schema.GroupKind{Kind: "ConfigMap"}, "test", field.ErrorList{
+				field.Invalid(field.NewPath("metadata", "annotations"), "x", "denied by webhook"),
+			}),
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedCode:   ErrorCodeInvalid,
+			expectedReason: "Invalid",
+		},
+		{
+			name:           "other kubernetes error",
+			err:            kerr.NewServiceUnavailable("unavailable"),
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedCode:   ErrorCodeKubernetes,
+			expectedReason: "ServiceUnavailable",
+		},
+		{
+			name:           "generic error",
+			err:            errors.New("connection refused"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   ErrorCodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(requestID())
+			router.GET("/", func(c *gin.Context) {
+				abortWithKubernetesError(c, tt.err)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+			req.Header.Set(headerRequestID, "req-1")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			assert.Equal(t, "req-1", rec.Header().Get(headerRequestID))
+
+			var body ErrorResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+			assert.Equal(t, tt.expectedCode, body.Code)
+			assert.Equal(t, tt.expectedReason, body.Reason)
+			assert.NotEmpty(t, body.Message)
+			assert.Equal(t, "req-1", body.RequestID)
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(requestID())
+	router.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(contextKeyRequestID))
+	})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+
+	assert.NotEmpty(t, rec.Body.String())
+	assert.Equal(t, rec.Body.String(), rec.Header().Get(headerRequestID))
+}
+
+func TestRecovery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(requestID(), recovery())
+	router.GET("/", func(*gin.Context) {
+		panic("secret internal state")
+	})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "secret")
+
+	var body ErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, ErrorCodeInternal, body.Code)
+	assert.Equal(t, "Internal server error", body.Message)
+}
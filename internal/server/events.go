@@ -0,0 +1,230 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	contentTypeEventStream = "text/event-stream"
+
+	// headerEventStreamID returns the ID of the event stream of a touch.
+	headerEventStreamID = "X-Event-Stream-Id"
+
+	// streamRetention is how long the events of a touch are kept for late subscribers.
+	streamRetention = time.Minute
+	// maxStreamEvents limits the number of events kept per touch.
+	maxStreamEvents = 100
+)
+
+var (
+	eventStreamTimeout   = 2 * time.Minute
+	eventStreamKeepalive = 15 * time.Second
+)
+
+// EventType is the type of touch lifecycle event.
+type EventType string
+
+const (
+	EventPatched  EventType = "patched"
+	EventWatching EventType = "watching"
+	EventChanged  EventType = "changed"
+	EventDone     EventType = "done"
+	EventFailed   EventType = "failed"
+)
+
+func (t EventType) terminal() bool {
+	return t == EventDone || t == EventFailed
+}
+
+// ProgressEvent is a touch lifecycle event streamed to the UI.
+type ProgressEvent struct {
+	ID      int       `json:"id"`
+	Type    EventType `json:"type"`
+	Message string    `json:"message,omitempty"`
+	Time    time.Time `json:"time"`
+	Data    any       `json:"data,omitempty"`
+}
+
+type stream struct {
+	owner       string
+	events      []ProgressEvent
+	subscribers map[chan ProgressEvent]struct{}
+	done        bool
+	expires     time.Time
+}
+
+// broker keeps the events per stream and distributes them to subscribers.
+// Streams are created by the touch with a server generated ID and may only be read by the user who touched.
+// Anonymous touches have no stream, as their callers can not be told apart.
+// Subscribers may subscribe before the first event is published or after the last one.
+type broker struct {
+	mu      sync.Mutex
+	streams map[string]*stream
+}
+
+func newBroker() *broker {
+	return &broker{streams: make(map[string]*stream)}
+}
+
+// create starts a new stream of the given user and returns its ID, or an empty ID without user.
+func (b *broker) create(owner string) string {
+	if owner == "" {
+		return ""
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expire()
+
+	id := uuid.NewString()
+	b.streams[id] = &stream{
+		owner:       owner,
+		subscribers: make(map[chan ProgressEvent]struct{}),
+		expires:     now().Add(eventStreamTimeout),
+	}
+	return id
+}
+
+// expire removes expired streams without subscribers, the caller must hold the lock.
+func (b *broker) expire() {
+	t := now()
+	for k, s := range b.streams {
+		if t.After(s.expires) && len(s.subscribers) == 0 {
+			delete(b.streams, k)
+		}
+	}
+}
+
+// publish adds an event to the stream.
+func (b *broker) publish(id string, eventType EventType, msg string, data any) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s, ok := b.streams[id]
+	if !ok || s.done || len(s.events) >= maxStreamEvents {
+		return
+	}
+
+	e := ProgressEvent{ID: len(s.events) + 1, Type: eventType, Message: msg, Time: now(), Data: data}
+	s.events = append(s.events, e)
+	for ch := range s.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+
+	if eventType.terminal() {
+		s.done = true
+		s.expires = now().Add(streamRetention)
+		for ch := range s.subscribers {
+			close(ch)
+		}
+		clear(s.subscribers)
+	}
+}
+
+// subscribe returns the events published so far and a channel receiving further events.
+// The channel is closed after a terminal event. The returned func must be called to unsubscribe.
+// If the stream does not exist, belongs to another user or the user is empty, ok is false.
+func (b *broker) subscribe(
+	id, user string,
+) (past []ProgressEvent, events <-chan ProgressEvent, unsubscribe func(), ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expire()
+
+	s, found := b.streams[id]
+	if !found || user == "" || s.owner != user {
+		return nil, nil, nil, false
+	}
+
+	past = append([]ProgressEvent(nil), s.events...)
+	ch := make(chan ProgressEvent, maxStreamEvents)
+	if s.done {
+		close(ch)
+		return past, ch, func() {}, true
+	}
+
+	s.subscribers[ch] = struct{}{}
+	return past, ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := s.subscribers[ch]; ok {
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+	}, true
+}
+
+// handleEvents streams the lifecycle events of a touch as server-sent events.
+func handleEvents(b *broker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		past, events, unsubscribe, ok := b.subscribe(c.Param("streamId"), c.GetHeader(headerArgoCDUsername))
+		if !ok {
+			// streams of other users are not revealed
+			abortWithError(c, http.StatusNotFound, ErrorCodeNotFound, "Event stream not found", nil)
+			return
+		}
+		defer unsubscribe()
+
+		c.Header("Content-Type", contentTypeEventStream)
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		// disable response buffering of nginx based proxies
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+
+		for _, e := range past {
+			if writeEvent(c.Writer, e) != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+
+		timeout := time.NewTimer(eventStreamTimeout)
+		defer timeout.Stop()
+		keepalive := time.NewTicker(eventStreamKeepalive)
+		defer keepalive.Stop()
+
+		for {
+			select {
+			case <-c.Request.Context().Done():
+				return
+			case <-timeout.C:
+				_ = writeEvent(c.Writer, ProgressEvent{Type: EventFailed, Message: "Event stream timed out", Time: now()})
+				c.Writer.Flush()
+				return
+			case <-keepalive.C:
+				if _, err := io.WriteString(c.Writer, ": keepalive\n\n"); err != nil {
+					return
+				}
+			case e, ok := <-events:
+				if !ok {
+					return
+				}
+				if writeEvent(c.Writer, e) != nil {
+					return
+				}
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+func writeEvent(w io.Writer, e ProgressEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
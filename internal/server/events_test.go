@@ -0,0 +1,119 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroker(t *testing.T) {
+	b := newBroker()
+
+	id := b.create("alice")
+	assert.NotEqual(t, id, b.create("alice"), "stream IDs are unique")
+	b.publish(id, EventPatched, "Annotation added", nil)
+
+	_, _, _, ok := b.subscribe(id, "bob")
+	assert.False(t, ok, "streams of other users can not be read")
+	_, _, _, ok = b.subscribe("unknown", "alice")
+	assert.False(t, ok)
+	assert.NotContains(t, b.streams, "unknown", "subscribing does not create streams")
+
+	past, events, unsubscribe, ok := b.subscribe(id, "alice")
+	require.True(t, ok)
+	defer unsubscribe()
+	require.Len(t, past, 1)
+	assert.Equal(t, EventPatched, past[0].Type)
+
+	b.publish(id, EventChanged, "Condition Ready is True", nil)
+	b.publish(id, EventDone, "Touched", nil)
+	b.publish(id, EventChanged, "ignored after terminal event", nil)
+
+	var received []EventType
+	for e := range events {
+		received = append(received, e.Type)
+	}
+	assert.Equal(t, []EventType{EventChanged, EventDone}, received)
+
+	past, events, _, ok = b.subscribe(id, "alice")
+	require.True(t, ok)
+	assert.Len(t, past, 3, "late subscribers get all events")
+	_, open := <-events
+	assert.False(t, open)
+
+	b.publish("unknown", EventDone, "without stream", nil)
+	assert.NotContains(t, b.streams, "unknown")
+
+	assert.Empty(t, b.create(""), "anonymous touches have no stream")
+	_, _, _, ok = b.subscribe(b.create("alice"), "")
+	assert.False(t, ok, "anonymous callers can not read streams")
+}
+
+func TestHandleEvents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("replay of finished request", func(t *testing.T) {
+		b := newBroker()
+		id := b.create("alice")
+		b.publish(id, EventPatched, "Annotation added", nil)
+		b.publish(id, EventDone, "Touched", nil)
+
+		router := gin.New()
+		router.GET("/events/:streamId", handleEvents(b))
+
+		req := httptest.NewRequest(http.MethodGet, "/events/"+id, http.NoBody)
+		req.Header.Set(headerArgoCDUsername, "alice")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, contentTypeEventStream, rec.Header().Get("Content-Type"))
+		body := rec.Body.String()
+		assert.Contains(t, body, "id: 1\nevent: patched\ndata: {")
+		assert.Contains(t, body, "id: 2\nevent: done\ndata: {")
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		eventStreamTimeout = 20 * time.Millisecond
+		eventStreamKeepalive = 5 * time.Millisecond
+		defer func() {
+			eventStreamTimeout = 2 * time.Minute
+			eventStreamKeepalive = 15 * time.Second
+		}()
+
+		b := newBroker()
+		router := gin.New()
+		router.GET("/events/:streamId", handleEvents(b))
+
+		req := httptest.NewRequest(http.MethodGet, "/events/"+b.create("alice"), http.NoBody)
+		req.Header.Set(headerArgoCDUsername, "alice")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		body := rec.Body.String()
+		assert.Contains(t, body, ": keepalive\n\n")
+		assert.True(t, strings.HasSuffix(body, "\n\n"))
+		assert.Contains(t, body, "event: failed")
+	})
+
+	t.Run("stream of another user", func(t *testing.T) {
+		b := newBroker()
+		id := b.create("alice")
+
+		router := gin.New()
+		router.GET("/events/:streamId", handleEvents(b))
+
+		req := httptest.NewRequest(http.MethodGet, "/events/"+id, http.NoBody)
+		req.Header.Set(headerArgoCDUsername, "bob")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
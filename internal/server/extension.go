@@ -1,9 +1,16 @@
 package server
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/bakito/argocd-touch-extension/internal/extension"
+	"github.com/bakito/argocd-touch-extension/internal/signature"
 	"github.com/gin-gonic/gin"
 )
 
@@ -12,51 +19,147 @@ const (
 	contentTypeJS   = "application/javascript"
 	contentTypeTAR  = "application/x-tar"
 
-	extensionFileName = "extension.tar.gz"
-	ExtensionChecksum = "extension_checksum.txt"
+	contentTypeText = "text/plain; charset=utf-8"
+
+	extensionFileName = extension.ExtensionArchive
+	ExtensionChecksum = extension.ExtensionChecksum
+
+	// cacheControl lets clients store the assets, but revalidate them with the ETag before reuse,
+	// as they change with the configuration of the server.
+	cacheControl = "no-cache"
+	encodingGzip = "gzip"
 )
 
-// createHandler creates a gin.HandlerFunc that returns data with a specified content type.
-func createHandler(contentType string, dataFn func() []byte) gin.HandlerFunc {
+// asset is a file served with an ETag, the content does not change while the server is running.
+type asset struct {
+	fileName    string
+	contentType string
+	data        []byte
+	etag        string
+	gzipped     []byte
+	gzipETag    string
+}
+
+// newAsset creates an asset with the checksum as ETag, the checksum is calculated if empty.
+// If fileName is set, the asset is served as attachment. Compressed assets are also served with gzip encoding.
+func newAsset(fileName, contentType string, data []byte, checksum string, compress bool) *asset {
+	if checksum == "" {
+		sum := sha256.Sum256(data)
+		checksum = hex.EncodeToString(sum[:])
+	}
+	a := &asset{
+		fileName:    fileName,
+		contentType: contentType,
+		data:        data,
+		etag:        `"` + checksum + `"`,
+	}
+	if compress {
+		var buf bytes.Buffer
+		gw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		if _, err := gw.Write(data); err == nil && gw.Close() == nil {
+			a.gzipped = buf.Bytes()
+			a.gzipETag = `"` + checksum + `-gzip"`
+		}
+	}
+	return a
+}
+
+func (a *asset) handler() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Data(http.StatusOK, contentType, dataFn())
+		data, etag := a.data, a.etag
+		gzipped := a.gzipped != nil && acceptsGzip(c.GetHeader("Accept-Encoding"))
+		if gzipped {
+			data, etag = a.gzipped, a.gzipETag
+		}
+
+		c.Header("Cache-Control", cacheControl)
+		c.Header("ETag", etag)
+		if a.gzipped != nil {
+			c.Header("Vary", "Accept-Encoding")
+		}
+		if matchesETag(c.GetHeader("If-None-Match"), etag) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+
+		if a.fileName != "" {
+			c.Header("Content-Disposition", "attachment; filename="+a.fileName)
+		}
+		if gzipped {
+			c.Header("Content-Encoding", encodingGzip)
+		}
+		c.Data(http.StatusOK, a.contentType, data)
+	}
+}
+
+// matchesETag returns true if the If-None-Match header contains the ETag, using the weak comparison of RFC 9110.
+func matchesETag(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for candidate := range strings.SplitSeq(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsGzip returns true if the Accept-Encoding header allows gzip.
+func acceptsGzip(acceptEncoding string) bool {
+	for coding := range strings.SplitSeq(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(coding, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != encodingGzip && name != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err != nil || v == 0 {
+				return false
+			}
+		}
+		return true
 	}
+	return false
 }
 
 // configHandler returns extension configuration.
 func configHandler(ext extension.Extension) gin.HandlerFunc {
-	return createHandler(contentTypeYAML, ext.ArgoCDConfig)
+	return newAsset("", contentTypeYAML, ext.ArgoCDConfig(), "", false).handler()
 }
 
 // jsHandler returns extension js extension.
 func jsHandler(ext extension.Extension) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Header("Content-Disposition", "attachment; filename="+extension.ExtensionJS)
-		js, _ := ext.ExtensionJS()
-		c.Data(http.StatusOK, contentTypeJS, js)
-	}
+	js, checksum := ext.ExtensionJS()
+	return newAsset(extension.ExtensionJS, contentTypeJS, js, checksum, true).handler()
 }
 
 // tarHandler returns extension tar archive.
 func tarHandler(ext extension.Extension) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Header("Content-Disposition", "attachment; filename="+extensionFileName)
-		tarGZ, _ := ext.ExtensionTarGz()
-		c.Data(http.StatusOK, contentTypeTAR, tarGZ)
-	}
+	tarGZ, checksum := ext.ExtensionTarGz()
+	return newAsset(extensionFileName, contentTypeTAR, tarGZ, checksum, false).handler()
 }
 
-// tarChecksumHandler returns extension tar archive.
+// tarChecksumHandler returns the checksums of the extension tar archive and js.
 func tarChecksumHandler(ext extension.Extension) gin.HandlerFunc {
+	return newAsset(ExtensionChecksum, contentTypeText, ext.Checksums(), "", false).handler()
+}
+
+// signatureHandler returns the detached signature of the named asset.
+func signatureHandler(ext extension.Extension, name string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Header("Content-Disposition", "attachment; filename="+ExtensionChecksum)
-		_, csTar := ext.ExtensionTarGz()
-		_, csjs := ext.ExtensionJS()
-		c.String(http.StatusOK, "%s  %s\n%s  %s", csTar, extensionFileName, csjs, extension.ExtensionJS)
+		sig, ok := ext.Signature(name)
+		if !ok {
+			abortWithError(c, http.StatusNotFound, ErrorCodeNotFound, "Signing is not enabled", nil)
+			return
+		}
+		c.Header("Content-Disposition", "attachment; filename="+name+signature.Suffix)
+		c.Data(http.StatusOK, contentTypeText, sig)
 	}
 }
 
 // rbacHandler returns extension RBAC configuration.
 func rbacHandler(ext extension.Extension) gin.HandlerFunc {
-	return createHandler(contentTypeYAML, ext.ProxyRBAC)
+	return newAsset("", contentTypeYAML, ext.ProxyRBAC(), "", false).handler()
 }
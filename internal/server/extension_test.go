@@ -0,0 +1,134 @@
+package server
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bakito/argocd-touch-extension/internal/extension"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignatureHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		signatures map[string][]byte
+		code       int
+		body       string
+	}{
+		{
+			name:       "signed",
+			signatures: map[string][]byte{extension.ExtensionJS: []byte("c2lnbmF0dXJl\n")},
+			code:       http.StatusOK,
+			body:       "c2lnbmF0dXJl\n",
+		},
+		{name: "signing disabled", code: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/sig", signatureHandler(&fakeExtension{signatures: tt.signatures}, extension.ExtensionJS))
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/sig", http.NoBody))
+
+			assert.Equal(t, tt.code, rec.Code)
+			if tt.code == http.StatusOK {
+				assert.Equal(t, tt.body, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestJSHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/js", jsHandler(&fakeExtension{js: []byte("console.log('touch')")}))
+
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		code     int
+		etag     string
+		encoding string
+	}{
+		{name: "full body", code: http.StatusOK, etag: `"checksum"`},
+		{name: "not modified", headers: map[string]string{"If-None-Match": `"checksum"`}, code: http.StatusNotModified},
+		{name: "weak etag", headers: map[string]string{"If-None-Match": `"other", W/"checksum"`}, code: http.StatusNotModified},
+		{name: "any etag", headers: map[string]string{"If-None-Match": "*"}, code: http.StatusNotModified},
+		{name: "modified", headers: map[string]string{"If-None-Match": `"other"`}, code: http.StatusOK, etag: `"checksum"`},
+		{
+			name:     "gzip",
+			headers:  map[string]string{"Accept-Encoding": "deflate, gzip;q=0.5"},
+			code:     http.StatusOK,
+			etag:     `"checksum-gzip"`,
+			encoding: "gzip",
+		},
+		{
+			name:    "gzip not modified",
+			headers: map[string]string{"Accept-Encoding": "gzip", "If-None-Match": `"checksum-gzip"`},
+			code:    http.StatusNotModified,
+		},
+		{
+			name:    "gzip refused",
+			headers: map[string]string{"Accept-Encoding": "gzip;q=0"},
+			code:    http.StatusOK,
+			etag:    `"checksum"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/js", http.NoBody)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.code, rec.Code)
+			assert.Equal(t, cacheControl, rec.Header().Get("Cache-Control"))
+			assert.Equal(t, "Accept-Encoding", rec.Header().Get("Vary"))
+			if tt.code == http.StatusNotModified {
+				assert.Empty(t, rec.Body.String())
+				return
+			}
+			assert.Equal(t, tt.etag, rec.Header().Get("ETag"))
+			assert.Equal(t, tt.encoding, rec.Header().Get("Content-Encoding"))
+
+			body := io.Reader(rec.Body)
+			if tt.encoding == "gzip" {
+				gr, err := gzip.NewReader(rec.Body)
+				require.NoError(t, err)
+				body = gr
+			}
+			data, err := io.ReadAll(body)
+			require.NoError(t, err)
+			assert.Equal(t, "console.log('touch')", string(data))
+		})
+	}
+}
+
+func TestConfigHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/config", configHandler(&fakeExtension{}))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/config", http.NoBody))
+	require.Equal(t, http.StatusOK, rec.Code)
+	etag := rec.Header().Get("ETag")
+	assert.Len(t, etag, 66, "quoted sha256")
+	assert.Empty(t, rec.Header().Get("Vary"))
+
+	req := httptest.NewRequest(http.MethodGet, "/config", http.NoBody)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bakito/argocd-touch-extension/internal/extension"
+	"github.com/bakito/argocd-touch-extension/internal/k8s"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	PathHealthz = "/healthz"
+	PathReadyz  = "/readyz"
+
+	statusOK     = "ok"
+	statusFailed = "failed"
+)
+
+// pingTimeout is the max duration of the API server connectivity check.
+var pingTimeout = 3 * time.Second
+
+// HealthResponse is the result of the health checks.
+type HealthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+type check struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// handleHealthz reports the liveness of the process, it does not depend on external systems.
+func handleHealthz() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, HealthResponse{Status: statusOK})
+	}
+}
+
+// handleReadyz reports if the server can handle touch requests.
+// The resources and assets are resolved once at startup, so their checks report the static result.
+func handleReadyz(cl k8s.Client, ext extension.Extension) gin.HandlerFunc {
+	resourcesErr, assetsErr := checkResources(ext), checkAssets(ext)
+	checks := []check{
+		{name: "kubernetes", run: func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+			defer cancel()
+			return cl.Ping(ctx)
+		}},
+		{name: "resources", run: func(context.Context) error { return resourcesErr }},
+		{name: "extension", run: func(context.Context) error { return assetsErr }},
+	}
+
+	return func(c *gin.Context) {
+		resp := HealthResponse{Status: statusOK, Checks: make(map[string]string, len(checks))}
+		status := http.StatusOK
+		for _, ch := range checks {
+			if err := ch.run(c.Request.Context()); err != nil {
+				resp.Status = statusFailed
+				resp.Checks[ch.name] = err.Error()
+				status = http.StatusServiceUnavailable
+			} else {
+				resp.Checks[ch.name] = statusOK
+			}
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// checkResources verifies that name and version of all resources were resolved.
+func checkResources(ext extension.Extension) error {
+	var errs []error
+	for key, res := range ext.Resources() {
+		if res.Name == "" || res.Version == "" {
+			errs = append(errs, fmt.Errorf("resource %q is not resolved", key))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkAssets verifies that all extension assets were rendered.
+func checkAssets(ext extension.Extension) error {
+	if js, _ := ext.ExtensionJS(); len(js) == 0 {
+		return errors.New("extension script is empty")
+	}
+	if tar, _ := ext.ExtensionTarGz(); len(tar) == 0 {
+		return errors.New("extension archive is empty")
+	}
+	if len(ext.ArgoCDConfig()) == 0 {
+		return errors.New("argo cd config is empty")
+	}
+	if len(ext.ProxyRBAC()) == 0 {
+		return errors.New("proxy rbac is empty")
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bakito/argocd-touch-extension/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeExtension is an extension.Extension with static assets.
+type fakeExtension struct {
+	resources  map[string]config.Resource
+	js         []byte
+	signatures map[string][]byte
+}
+
+func (f *fakeExtension) Resources() map[string]config.Resource { return f.resources }
+func (*fakeExtension) ExtensionTarGz() ([]byte, string)        { return []byte("tar"), "checksum" }
+func (f *fakeExtension) ExtensionJS() ([]byte, string)         { return f.js, "checksum" }
+func (*fakeExtension) Checksums() []byte                       { return []byte("checksums") }
+func (*fakeExtension) ArgoCDConfig() []byte                    { return []byte("config") }
+func (*fakeExtension) ProxyRBAC() []byte                       { return []byte("rbac") }
+
+func (f *fakeExtension) Signature(name string) ([]byte, bool) {
+	sig, ok := f.signatures[name]
+	return sig, ok
+}
+
+func TestHandleHealthz(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET(PathHealthz, handleHealthz())
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, PathHealthz, http.NoBody))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, rec.Body.String())
+}
+
+func TestHandleReadyz(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	resolved := map[string]config.Resource{"cm": {Version: "v1", Kind: "ConfigMap", Name: "configmaps"}}
+
+	tests := []struct {
+		name      string
+		clientErr error
+		ext       *fakeExtension
+		status    int
+		checks    map[string]string
+	}{
+		{
+			name:   "ready",
+			ext:    &fakeExtension{resources: resolved, js: []byte("js")},
+			status: http.StatusOK,
+			checks: map[string]string{"kubernetes": "ok", "resources": "ok", "extension": "ok"},
+		},
+		{
+			name:      "api server unreachable",
+			clientErr: errors.New("connection refused"),
+			ext:       &fakeExtension{resources: resolved, js: []byte("js")},
+			status:    http.StatusServiceUnavailable,
+			checks:    map[string]string{"kubernetes": "connection refused", "resources": "ok", "extension": "ok"},
+		},
+		{
+			name: "unresolved resource",
+			ext: &fakeExtension{
+				resources: map[string]config.Resource{"cm": {Kind: "ConfigMap"}},
+				js:        []byte("js"),
+			},
+			status: http.StatusServiceUnavailable,
+			checks: map[string]string{
+				"kubernetes": "ok",
+				"resources":  `resource "cm" is not resolved`,
+				"extension":  "ok",
+			},
+		},
+		{
+			name:   "assets not rendered",
+			ext:    &fakeExtension{resources: resolved},
+			status: http.StatusServiceUnavailable,
+			checks: map[string]string{"kubernetes": "ok", "resources": "ok", "extension": "extension script is empty"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := newFakeClient()
+			cl.err = tt.clientErr
+			router := gin.New()
+			router.GET(PathReadyz, handleReadyz(cl, tt.ext))
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, PathReadyz, http.NoBody))
+
+			assert.Equal(t, tt.status, rec.Code)
+			var resp HealthResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, tt.checks, resp.Checks)
+			if tt.status == http.StatusOK {
+				assert.Equal(t, statusOK, resp.Status)
+			} else {
+				assert.Equal(t, statusFailed, resp.Status)
+			}
+		})
+	}
+}
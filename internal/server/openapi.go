@@ -0,0 +1,435 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/bakito/argocd-touch-extension/internal/config"
+	"github.com/bakito/argocd-touch-extension/internal/extension"
+	"github.com/bakito/argocd-touch-extension/internal/k8s"
+	"github.com/bakito/argocd-touch-extension/internal/signature"
+	"github.com/bakito/argocd-touch-extension/internal/version"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	APIPathOpenAPI = "/openapi.json"
+
+	openAPIVersion = "3.0.3"
+	schemaRef      = "#/components/schemas/"
+	parameterRef   = "#/components/parameters/"
+	responseRef    = "#/components/responses/"
+)
+
+type object = map[string]any
+
+// handleOpenAPI serves the OpenAPI document, it is generated once as the routes do not change at runtime.
+// The status and schedule paths are only documented if they are not served on the admin port.
+func handleOpenAPI(ext extension.Extension, serviceAddress string, operations bool) gin.HandlerFunc {
+	doc := openAPI(ext.Resources(), serviceAddress, operations)
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, doc)
+	}
+}
+
+// openAPI returns the OpenAPI document with the touch paths of all resources.
+func openAPI(resources map[string]config.Resource, serviceAddress string, operations bool) object {
+	paths := object{
+		APIPathV1 + APIPathOpenAPI: object{"get": operation("getOpenAPI", "OpenAPI document of this API", "meta",
+			object{"200": jsonResponse("The OpenAPI document", object{"type": "object"})}),
+		},
+	}
+	if operations {
+		paths[APIPathV1+APIPathStatus] = object{"get": operation("getStatus", "Version and leader election state", "meta",
+			object{"200": jsonResponse("The status of the replica", ref(schemaRef+"Status"))}),
+		}
+		schedules := object{"type": "array", "items": ref(schemaRef + "Schedule")}
+		paths[APIPathV1+APIPathSchedules] = object{"get": operation("getSchedules", "Schedules with their next and last run",
+			"meta", object{"200": jsonResponse("The schedules", schedules)}),
+		}
+	}
+	addAssetPaths(paths)
+	addBatchPath(paths)
+
+	keys := make([]string, 0, len(resources))
+	for key := range resources {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		addTouchPaths(paths, key, resources[key])
+	}
+
+	doc := object{
+		"openapi": openAPIVersion,
+		"info": object{
+			"title":       "Argo CD Touch Extension",
+			"description": "Touches Kubernetes objects by adding an annotation, called through the Argo CD proxy extension.",
+			"version":     version.Version,
+		},
+		"paths": paths,
+		"components": object{
+			"schemas":    schemas(),
+			"parameters": parameters(),
+			"responses":  errorResponses(),
+		},
+	}
+	if serviceAddress != "" {
+		doc["servers"] = []object{{"url": serviceAddress}}
+	}
+	return doc
+}
+
+func addAssetPaths(paths object) {
+	assets := []struct {
+		file, id, summary, contentType string
+	}{
+		{extension.ExtensionJS, "getExtensionJS", "The UI extension script", contentTypeJS},
+		{extensionFileName, "getExtensionArchive", "The UI extension as archive for the extension installer", contentTypeTAR},
+		{ExtensionChecksum, "getExtensionChecksum", "SHA-256 checksums of the archive and the script", "text/plain"},
+		{"config", "getArgoCDConfig", "Argo CD helm values to enable the extension", contentTypeYAML},
+		{"rbac", "getProxyRBAC", "RBAC rules required by the extension", contentTypeYAML},
+		{
+			extension.ExtensionJS + signature.Suffix, "getExtensionJSSignature",
+			"Base64 encoded ed25519 signature of the script, if signing is enabled", "text/plain",
+		},
+		{
+			extensionFileName + signature.Suffix, "getExtensionArchiveSignature",
+			"Base64 encoded ed25519 signature of the archive, if signing is enabled", "text/plain",
+		},
+		{
+			ExtensionChecksum + signature.Suffix, "getExtensionChecksumSignature",
+			"Base64 encoded ed25519 signature of the checksums, if signing is enabled", "text/plain",
+		},
+	}
+	for _, a := range assets {
+		ok := object{
+			"description": a.summary,
+			"content":     object{a.contentType: object{"schema": object{"type": "string"}}},
+		}
+		responses := object{"200": ok}
+		op := operation(a.id, a.summary, "extension", responses)
+		if !strings.HasSuffix(a.file, signature.Suffix) {
+			ok["headers"] = object{
+				"ETag": object{"description": "SHA-256 checksum of the content", "schema": object{"type": "string"}},
+			}
+			responses["304"] = object{"description": "The asset did not change"}
+			op["parameters"] = []object{{
+				"name":        "If-None-Match",
+				"in":          "header",
+				"description": "ETag of a previous response",
+				"schema":      object{"type": "string"},
+			}}
+		}
+		paths[APIPathV1+APIPathExtension+a.file] = object{"get": op}
+	}
+}
+
+func addTouchPaths(paths object, key string, res config.Resource) {
+	path := fmt.Sprintf("%s%s/%s/{namespace}/{name}", APIPathV1, apiPatchTouch, key)
+	kind := res.Kind
+	if res.Group != "" {
+		kind += "." + res.Group
+	}
+	params := []object{
+		ref(parameterRef + "Namespace"),
+		ref(parameterRef + "Name"),
+		ref(parameterRef + "ApplicationName"),
+		ref(parameterRef + "ProjectName"),
+		{
+			"name":        headerArgocdExtensionName,
+			"in":          "header",
+			"required":    true,
+			"description": "Name of the extension, set by the Argo CD proxy extension config",
+			"schema":      object{"type": "string", "enum": []string{key}},
+		},
+	}
+
+	touched := jsonResponse("The object was touched", ref(schemaRef+"TouchResponse"))
+	touched["headers"] = object{
+		headerEventStreamID: object{
+			"description": "ID of the event stream of the touch, only set if the username is known",
+			"schema":      object{"type": "string"},
+		},
+	}
+	touch := operation("touch_"+key, "Touch "+kind, key, object{
+		"200": touched,
+		"429": ref(responseRef + "TooManyRequests"),
+	})
+	touch["parameters"] = append(params,
+		ref(parameterRef+"Username"),
+		ref(parameterRef+"RequestID"),
+		ref(parameterRef+"DryRun"),
+		ref(parameterRef+"Wait"),
+	)
+	state := operation("getState_"+key, "Last touch, history and status of "+kind, key, object{
+		"200": jsonResponse("The touch state of the object", ref(schemaRef+"State")),
+	})
+	state["parameters"] = params
+	paths[path] = object{"put": touch, "get": state}
+
+	events := operation("getEvents_"+key, "Server-sent events of a touch of "+kind, key, object{
+		"200": object{
+			"description": "The stream of touch events",
+			"content":     object{contentTypeEventStream: object{"schema": object{"type": "string"}}},
+		},
+	})
+	events["parameters"] = append(params, ref(parameterRef+"Username"), object{
+		"name":        "streamId",
+		"in":          "path",
+		"required":    true,
+		"description": "The event stream ID returned by the touch, only the user who touched may read it",
+		"schema":      object{"type": "string"},
+	})
+	paths[path+"/events/{streamId}"] = object{"get": events}
+}
+
+func addBatchPath(paths object) {
+	batch := operation("touchBatch", "Touch multiple objects of the resource of the extension", "batch", object{
+		"200": jsonResponse("The result per item and overall", ref(schemaRef+"BatchResponse")),
+		"429": ref(responseRef + "TooManyRequests"),
+	})
+	batch["parameters"] = []object{
+		ref(parameterRef + "ApplicationName"),
+		ref(parameterRef + "ProjectName"),
+		{
+			"name":        headerArgocdExtensionName,
+			"in":          "header",
+			"required":    true,
+			"description": "Name of the extension, all items must belong to its resource",
+			"schema":      object{"type": "string"},
+		},
+		ref(parameterRef + "Username"),
+		ref(parameterRef + "DryRun"),
+	}
+	batch["requestBody"] = object{
+		"required": true,
+		"content":  object{"application/json": object{"schema": ref(schemaRef + "BatchRequest")}},
+	}
+	paths[APIPathV1+apiPatchTouch+apiPathBatch] = object{"post": batch}
+}
+
+// operation returns an operation with the given responses and the default error response.
+func operation(id, summary, tag string, responses object) object {
+	responses["default"] = ref(responseRef + "Error")
+	return object{
+		"operationId": id,
+		"summary":     summary,
+		"tags":        []string{tag},
+		"responses":   responses,
+	}
+}
+
+func jsonResponse(description string, schema object) object {
+	return object{
+		"description": description,
+		"content":     object{"application/json": object{"schema": schema}},
+	}
+}
+
+func ref(r string) object {
+	return object{"$ref": r}
+}
+
+func parameters() object {
+	header := func(name, description string, required bool) object {
+		return object{
+			"name":        name,
+			"in":          "header",
+			"required":    required,
+			"description": description,
+			"schema":      object{"type": "string"},
+		}
+	}
+	path := func(name, description string) object {
+		return object{
+			"name":        name,
+			"in":          "path",
+			"required":    true,
+			"description": description,
+			"schema":      object{"type": "string"},
+		}
+	}
+	query := func(name, description string) object {
+		return object{"name": name, "in": "query", "description": description, "schema": object{"type": "boolean"}}
+	}
+	return object{
+		"Namespace":       path("namespace", "Namespace of the object"),
+		"Name":            path("name", "Name of the object"),
+		"ApplicationName": header(headerArgocdAppName, "Application as <namespace>:<name>, set by Argo CD", true),
+		"ProjectName":     header(headerArgocdProjName, "Project of the application, set by Argo CD", true),
+		"Username":        header(headerArgoCDUsername, "User performing the touch, set by Argo CD", false),
+		"RequestID":       header(headerRequestID, "ID to correlate the request with its logs", false),
+		"DryRun":          query("dryRun", "Patch in dry run mode, it can not disable a global dry run"),
+		"Wait":            query("wait", "Set to false to skip waiting for the reconciliation"),
+	}
+}
+
+func errorResponses() object {
+	return object{
+		"Error": jsonResponse("Error, see the code for details", ref(schemaRef+"Error")),
+		"TooManyRequests": object{
+			"description": "Rate limit or cooldown exceeded",
+			"headers": object{
+				"Retry-After": object{"description": "Seconds until a retry", "schema": object{"type": "integer"}},
+			},
+			"content": object{"application/json": object{"schema": ref(schemaRef + "Error")}},
+		},
+	}
+}
+
+func schemas() object {
+	str := object{"type": "string"}
+	dateTime := object{"type": "string", "format": "date-time"}
+	touchRecord := object{
+		"type": "object",
+		"properties": object{
+			"time": dateTime,
+			"user": str,
+		},
+	}
+	return object{
+		"Error": object{
+			"type":     "object",
+			"required": []string{"code", "message"},
+			"properties": object{
+				"code":      object{"type": "string", "enum": errorCodes},
+				"message":   str,
+				"reason":    object{"type": "string", "description": "Reason of a Kubernetes API error"},
+				"details":   object{"type": "object", "description": "Details of a Kubernetes API error"},
+				"requestId": str,
+			},
+		},
+		"WaitStatus": object{
+			"type": "object",
+			"properties": object{
+				"result": object{
+					"type": "string",
+					"enum": []k8s.WaitResult{k8s.WaitResultReconciled, k8s.WaitResultFailed, k8s.WaitResultTimeout},
+				},
+				"message":         str,
+				"resourceVersion": str,
+				"duration":        str,
+			},
+		},
+		"TouchResponse": object{
+			"type": "object",
+			"properties": object{
+				"dryRun": object{"type": "boolean"},
+				"attempts": object{
+					"type":        "integer",
+					"description": "Number of patch attempts, including retries on transient errors and conflicts",
+				},
+				"resourceVersion": object{"type": "string", "description": "Resource version after the touch"},
+				"metadata":        object{"type": "object", "description": "Metadata of the touched object"},
+				"wait":            ref(schemaRef + "WaitStatus"),
+				"eventStream": object{
+					"type":        "string",
+					"description": "ID of the event stream of the touch, only set if the username is known",
+				},
+			},
+		},
+		"TouchRecord": touchRecord,
+		"State": object{
+			"type": "object",
+			"properties": object{
+				"resource":           str,
+				"group":              str,
+				"version":            str,
+				"kind":               str,
+				"namespace":          str,
+				"name":               str,
+				"resourceVersion":    str,
+				"generation":         object{"type": "integer"},
+				"observedGeneration": object{"type": "integer"},
+				"lastTouch":          ref(schemaRef + "TouchRecord"),
+				"history":            object{"type": "array", "items": ref(schemaRef + "TouchRecord")},
+				"conditions":         object{"type": "array", "items": object{"type": "object"}},
+			},
+		},
+		"BatchRequest": object{
+			"type":     "object",
+			"required": []string{"items"},
+			"properties": object{
+				"items": object{
+					"type":     "array",
+					"minItems": 1,
+					"maxItems": maxBatchItems,
+					"items": object{
+						"type":     "object",
+						"required": []string{"namespace", "name"},
+						"properties": object{
+							"resourceKey": object{"type": "string", "description": "Defaults to the extension name"},
+							"namespace":   str,
+							"name":        str,
+						},
+					},
+				},
+			},
+		},
+		"BatchResponse": object{
+			"type": "object",
+			"properties": object{
+				"status": object{
+					"type": "string",
+					"enum": []BatchStatus{BatchStatusAll, BatchStatusPartial, BatchStatusNone},
+				},
+				"dryRun":    object{"type": "boolean"},
+				"succeeded": object{"type": "integer"},
+				"failed":    object{"type": "integer"},
+				"items": object{
+					"type": "array",
+					"items": object{
+						"type": "object",
+						"properties": object{
+							"resourceKey":     str,
+							"namespace":       str,
+							"name":            str,
+							"status":          object{"type": "integer", "description": "HTTP status of the item"},
+							"attempts":        object{"type": "integer", "description": "Number of patch attempts"},
+							"resourceVersion": str,
+							"error":           ref(schemaRef + "Error"),
+						},
+					},
+				},
+			},
+		},
+		"Status": object{
+			"type": "object",
+			"properties": object{
+				"version": str,
+				"leader": object{
+					"type": "object",
+					"properties": object{
+						"enabled": object{"type": "boolean"},
+						"active": object{
+							"type":        "boolean",
+							"description": "Whether the replica takes part in the election, only if there are background tasks",
+						},
+						"lease":     str,
+						"namespace": str,
+						"identity":  str,
+						"leader":    object{"type": "boolean"},
+						"holder":    str,
+					},
+				},
+			},
+		},
+		"Schedule": object{
+			"type": "object",
+			"properties": object{
+				"resource":   str,
+				"name":       str,
+				"cron":       str,
+				"selector":   str,
+				"namespaces": object{"type": "array", "items": str},
+				"active":     object{"type": "boolean"},
+				"nextRun":    dateTime,
+				"lastRun":    dateTime,
+				"lastResult": str,
+			},
+		},
+	}
+}
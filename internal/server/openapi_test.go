@@ -0,0 +1,91 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bakito/argocd-touch-extension/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleOpenAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ext := &fakeExtension{resources: map[string]config.Resource{
+		"cm": {Version: "v1", Kind: "ConfigMap", Name: "configmaps"},
+		"es": {Group: "external-secrets.io", Version: "v1", Kind: "ExternalSecret", Name: "externalsecrets"},
+	}}
+	router := gin.New()
+	router.GET(APIPathOpenAPI, handleOpenAPI(ext, "https://touch:8080", false))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, APIPathOpenAPI, http.NoBody))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var doc map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	assert.Equal(t, openAPIVersion, doc["openapi"])
+	assert.Equal(t, []any{map[string]any{"url": "https://touch:8080"}}, doc["servers"])
+
+	paths := doc["paths"].(map[string]any)
+	for _, p := range []string{
+		"/v1/openapi.json",
+		"/v1/extension/extension-touch.js",
+		"/v1/extension/extension.tar.gz",
+		"/v1/extension/extension_checksum.txt",
+		"/v1/extension/config",
+		"/v1/extension/rbac",
+		"/v1/touch/batch",
+		"/v1/touch/cm/{namespace}/{name}",
+		"/v1/touch/es/{namespace}/{name}",
+		"/v1/touch/es/{namespace}/{name}/events/{streamId}",
+	} {
+		assert.Contains(t, paths, p)
+	}
+	assert.NotContains(t, paths, "/v1/status", "served on the admin port")
+	assert.NotContains(t, paths, "/v1/schedules", "served on the admin port")
+	assert.Contains(t, openAPI(ext.resources, "", true)["paths"], "/v1/status")
+
+	touch := paths["/v1/touch/es/{namespace}/{name}"].(map[string]any)["put"].(map[string]any)
+	assert.Equal(t, "touch_es", touch["operationId"])
+	assert.Equal(t, "Touch ExternalSecret.external-secrets.io", touch["summary"])
+	assert.Contains(t, touch["parameters"], map[string]any{
+		"name":        headerArgocdExtensionName,
+		"in":          "header",
+		"required":    true,
+		"description": "Name of the extension, set by the Argo CD proxy extension config",
+		"schema":      map[string]any{"type": "string", "enum": []any{"es"}},
+	})
+
+	schemas := doc["components"].(map[string]any)["schemas"].(map[string]any)
+	code := schemas["Error"].(map[string]any)["properties"].(map[string]any)["code"].(map[string]any)
+	assert.Len(t, code["enum"], len(errorCodes))
+
+	assertRefsResolve(t, doc, doc)
+}
+
+// assertRefsResolve checks that all references point to an existing component.
+func assertRefsResolve(t *testing.T, doc, node any) {
+	t.Helper()
+	switch n := node.(type) {
+	case map[string]any:
+		if r, ok := n["$ref"].(string); ok {
+			var target any = doc
+			for _, part := range strings.Split(strings.TrimPrefix(r, "#/"), "/") {
+				target = target.(map[string]any)[part]
+			}
+			assert.NotNil(t, target, r)
+		}
+		for _, v := range n {
+			assertRefsResolve(t, doc, v)
+		}
+	case []any:
+		for _, v := range n {
+			assertRefsResolve(t, doc, v)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bakito/argocd-touch-extension/internal/config"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+const userLimiterIdleTimeout = 10 * time.Minute
+
+// now is replaceable in tests.
+var now = time.Now
+
+// cooldown remembers until when each touched object must not be touched again.
+type cooldown struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+func newCooldown() *cooldown {
+	return &cooldown{until: make(map[string]time.Time)}
+}
+
+// reserve registers a touch of the object if the previous one is longer ago than the given duration.
+// Otherwise, the remaining time is returned.
+func (cd *cooldown) reserve(key string, d time.Duration) (time.Duration, bool) {
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+
+	t := now()
+	for k, until := range cd.until {
+		if !t.Before(until) {
+			delete(cd.until, k)
+		}
+	}
+
+	if until, ok := cd.until[key]; ok {
+		return until.Sub(t), false
+	}
+	cd.until[key] = t.Add(d)
+	return 0, true
+}
+
+// release removes a reservation, e.g. if the touch failed.
+func (cd *cooldown) release(key string) {
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+	delete(cd.until, key)
+}
+
+type userLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// userLimits is a token bucket per user.
+type userLimits struct {
+	mu       sync.Mutex
+	limit    rate.Limit
+	burst    int
+	limiters map[string]*userLimiter
+}
+
+func newUserLimits(cfg config.RateLimit) *userLimits {
+	if cfg.UserPerMinute <= 0 {
+		return nil
+	}
+	burst := cfg.UserBurst
+	if burst <= 0 {
+		burst = 1
+	}
+	return &userLimits{
+		limit:    rate.Limit(float64(cfg.UserPerMinute) / time.Minute.Seconds()),
+		burst:    burst,
+		limiters: make(map[string]*userLimiter),
+	}
+}
+
+// reserve takes a token for the user or returns the time until the next one is available.
+func (ul *userLimits) reserve(user string) (time.Duration, bool) {
+	ul.mu.Lock()
+	defer ul.mu.Unlock()
+
+	t := now()
+	for u, l := range ul.limiters {
+		if t.Sub(l.lastSeen) > userLimiterIdleTimeout {
+			delete(ul.limiters, u)
+		}
+	}
+
+	l, ok := ul.limiters[user]
+	if !ok {
+		l = &userLimiter{limiter: rate.NewLimiter(ul.limit, ul.burst)}
+		ul.limiters[user] = l
+	}
+	l.lastSeen = t
+
+	r := l.limiter.ReserveN(t, 1)
+	if delay := r.DelayFrom(t); delay > 0 {
+		r.CancelAt(t)
+		return delay, false
+	}
+	return 0, true
+}
+
+// limitUser takes a token of the user and aborts the request if none is left.
+// Dry runs do not touch anything and are not limited.
+func limitUser(c *gin.Context, limits *userLimits) bool {
+	if limits == nil || c.GetBool(contextKeyDryRun) {
+		return true
+	}
+	if retryAfter, ok := limits.reserve(limiterKey(c)); !ok {
+		tooManyRequests(c, retryAfter, ErrorCodeRateLimited, "Rate limit exceeded")
+		return false
+	}
+	return true
+}
+
+// limiterKey identifies the caller of a request. Requests without a username are limited per client address,
+// so anonymous callers do not share a single bucket.
+func limiterKey(c *gin.Context) string {
+	if user := c.GetHeader(headerArgoCDUsername); user != "" {
+		return "user:" + user
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// rateLimit rejects touches of a user exceeding the user limit or of an object still in its cooldown.
+func rateLimit(limits *userLimits, cd *cooldown, key string, res config.Resource) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetBool(contextKeyDryRun) {
+			c.Next()
+			return
+		}
+		if !limitUser(c, limits) {
+			return
+		}
+
+		if res.Cooldown.Duration <= 0 {
+			c.Next()
+			return
+		}
+
+		objectKey := key + "/" + c.Param("namespace") + "/" + c.Param("name")
+		if retryAfter, ok := cd.reserve(objectKey, res.Cooldown.Duration); !ok {
+			tooManyRequests(c, retryAfter, ErrorCodeCooldown, "Object was touched recently")
+			return
+		}
+
+		c.Next()
+
+		if c.Writer.Status() >= http.StatusMultipleChoices {
+			cd.release(objectKey)
+		}
+	}
+}
+
+func tooManyRequests(c *gin.Context, retryAfter time.Duration, code ErrorCode, msg string) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	abortWithError(c, http.StatusTooManyRequests, code, fmt.Sprintf("%s, retry in %ds", msg, seconds), gin.H{
+		"retryAfter": seconds,
+	})
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bakito/argocd-touch-extension/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCooldown(t *testing.T) {
+	current := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+
+	cd := newCooldown()
+
+	_, ok := cd.reserve("cm/default/a", 30*time.Second)
+	assert.True(t, ok)
+
+	current = current.Add(10 * time.Second)
+	remaining, ok := cd.reserve("cm/default/a", 30*time.Second)
+	assert.False(t, ok)
+	assert.Equal(t, 20*time.Second, remaining)
+
+	_, ok = cd.reserve("cm/default/b", 30*time.Second)
+	assert.True(t, ok, "other objects are not affected")
+
+	current = current.Add(20 * time.Second)
+	_, ok = cd.reserve("cm/default/a", 30*time.Second)
+	assert.True(t, ok, "cooldown expired")
+
+	cd.release("cm/default/a")
+	_, ok = cd.reserve("cm/default/a", 30*time.Second)
+	assert.True(t, ok, "released reservation")
+}
+
+func TestUserLimits(t *testing.T) {
+	current := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+
+	assert.Nil(t, newUserLimits(config.RateLimit{}))
+
+	ul := newUserLimits(config.RateLimit{UserPerMinute: 6, UserBurst: 2})
+
+	for range 2 {
+		_, ok := ul.reserve("alice")
+		assert.True(t, ok)
+	}
+	retryAfter, ok := ul.reserve("alice")
+	assert.False(t, ok)
+	assert.Equal(t, 10*time.Second, retryAfter)
+
+	_, ok = ul.reserve("bob")
+	assert.True(t, ok, "users are limited individually")
+
+	current = current.Add(10 * time.Second)
+	_, ok = ul.reserve("alice")
+	assert.True(t, ok)
+}
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name              string
+		status            int
+		expectedCodes     []int
+		expectedRetryHint string
+	}{
+		{
+			name:              "successful touch starts cooldown",
+			status:            http.StatusOK,
+			expectedCodes:     []int{http.StatusOK, http.StatusTooManyRequests},
+			expectedRetryHint: "30",
+		},
+		{
+			name:          "failed touch does not start cooldown",
+			status:        http.StatusNotFound,
+			expectedCodes: []int{http.StatusNotFound, http.StatusNotFound},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := config.Resource{Cooldown: config.Duration{Duration: 30 * time.Second}}
+			router := gin.New()
+			router.PUT("/cm/:namespace/:name", rateLimit(nil, newCooldown(), "cm", res), func(c *gin.Context) {
+				c.Status(tt.status)
+			})
+
+			var rec *httptest.ResponseRecorder
+			for _, code := range tt.expectedCodes {
+				rec = httptest.NewRecorder()
+				router.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/cm/default/a", http.NoBody))
+				assert.Equal(t, code, rec.Code)
+			}
+			assert.Equal(t, tt.expectedRetryHint, rec.Header().Get("Retry-After"))
+		})
+	}
+}
+
+func TestRateLimitUsers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	limits := newUserLimits(config.RateLimit{UserPerMinute: 1})
+	router := gin.New()
+	router.PUT("/cm/:namespace/:name", parseDryRun(false), rateLimit(limits, newCooldown(), "cm", config.Resource{}),
+		func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+	touch := func(target, user, remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodPut, target, http.NoBody)
+		req.RemoteAddr = remoteAddr
+		if user != "" {
+			req.Header.Set(headerArgoCDUsername, user)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, touch("/cm/default/a?dryRun=true", "alice", "10.0.0.1:1234"))
+	assert.Equal(t, http.StatusOK, touch("/cm/default/a", "alice", "10.0.0.1:1234"), "dry runs do not use tokens")
+	assert.Equal(t, http.StatusTooManyRequests, touch("/cm/default/a", "alice", "10.0.0.1:1234"))
+
+	assert.Equal(t, http.StatusOK, touch("/cm/default/a", "", "10.0.0.2:1234"))
+	assert.Equal(t, http.StatusOK, touch("/cm/default/a", "", "10.0.0.3:1234"), "anonymous callers are limited per address")
+	assert.Equal(t, http.StatusTooManyRequests, touch("/cm/default/a", "", "10.0.0.2:1234"))
+}
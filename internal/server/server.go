@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -15,11 +16,13 @@ import (
 	"github.com/bakito/argocd-touch-extension/internal/config"
 	"github.com/bakito/argocd-touch-extension/internal/extension"
 	"github.com/bakito/argocd-touch-extension/internal/k8s"
+	"github.com/bakito/argocd-touch-extension/internal/leader"
+	"github.com/bakito/argocd-touch-extension/internal/notify"
+	"github.com/bakito/argocd-touch-extension/internal/scheduler"
+	"github.com/bakito/argocd-touch-extension/internal/signature"
 	"github.com/bakito/argocd-touch-extension/internal/version"
 	"github.com/gin-gonic/gin"
 	sloggin "github.com/samber/slog-gin"
-	kerr "k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const (
@@ -31,32 +34,88 @@ const (
 	APIPathV1        = "/v1"
 	apiPatchTouch    = "/touch"
 	APIPathExtension = "/extension/"
+	APIPathSchedules = "/schedules"
+	APIPathStatus    = "/status"
+
+	contextKeyDryRun = "dryRun"
+
+	defaultListenAddress = ":8080"
 )
 
-func Run(ctx context.Context, client k8s.Client, ext extension.Extension, debug bool) error {
+// Options configure the server.
+type Options struct {
+	Debug     bool
+	Config    config.TouchConfig
+	Scheduler *scheduler.Scheduler
+	Leader    *leader.Elector
+}
+
+func Run(ctx context.Context, client k8s.Client, ext extension.Extension, notifier notify.Notifier, opts Options) error {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
-	router.Use(gin.Recovery())
+	router.Use(requestID(), recovery(), metrics())
+	router.NoRoute(func(c *gin.Context) {
+		abortWithError(c, http.StatusNotFound, ErrorCodeNotFound, "Route not found: "+c.Request.URL.Path, nil)
+	})
 
 	router.GET("/", func(c *gin.Context) {
 		c.String(http.StatusOK, "argocd-touch-extension")
 	})
 
+	health := func(r gin.IRoutes) {
+		r.GET(PathHealthz, handleHealthz())
+		r.GET(PathReadyz, handleReadyz(client, ext))
+	}
+	var admin *gin.Engine
+	if opts.Config.Server.AdminAddress != "" {
+		admin = adminRouter(ext, opts, health)
+	} else {
+		health(router)
+	}
+
 	v1 := router.Group(APIPathV1)
-	if debug {
+	if opts.Debug {
 		v1.Use(sloggin.New(slog.Default()))
 	}
 
+	v1.GET(APIPathOpenAPI, handleOpenAPI(ext, opts.Config.ServiceAddress, admin == nil))
+
+	// operational endpoints are kept off the proxy facing router if there is an admin port
+	var operations gin.IRoutes = v1
+	if admin != nil {
+		operations = admin.Group(APIPathV1)
+	}
+	if opts.Leader != nil {
+		operations.GET(APIPathStatus, handleStatus(opts.Leader))
+	}
+	if opts.Scheduler != nil {
+		operations.GET(APIPathSchedules, func(c *gin.Context) {
+			c.JSON(http.StatusOK, opts.Scheduler.Jobs())
+		})
+	}
+
 	v1Ext := v1.Group(APIPathExtension)
 
 	v1Ext.GET(extension.ExtensionJS, jsHandler(ext))
 	v1Ext.GET(extensionFileName, tarHandler(ext))
 	v1Ext.GET(ExtensionChecksum, tarChecksumHandler(ext))
+	for _, name := range []string{extension.ExtensionJS, extensionFileName, ExtensionChecksum} {
+		v1Ext.GET(name+signature.Suffix, signatureHandler(ext, name))
+	}
 	v1Ext.GET("config", configHandler(ext))
 	v1Ext.GET("rbac", rbacHandler(ext))
 
 	v1Touch := v1.Group(apiPatchTouch)
-	v1Touch.Use(validateArgocdHeaders())
+	if opts.Config.Server.TLS.ClientCAFile != "" {
+		v1Touch.Use(requireClientCert())
+	}
+	v1Touch.Use(validateArgocdHeaders(), parseDryRun(opts.Config.DryRun))
+
+	limits := newUserLimits(opts.Config.RateLimit)
+	cd := newCooldown()
+	events := newBroker()
+
+	v1Touch.POST(apiPathBatch, handleBatch(client, notifier, ext.Resources(), limits, cd, opts.Config.Retry))
 
 	for name, res := range ext.Resources() {
 		slog.With(
@@ -65,11 +124,18 @@ func Run(ctx context.Context, client k8s.Client, ext extension.Extension, debug
 			"version", res.Version,
 			"kind", res.Kind,
 			"path", v1Touch.BasePath()+"/"+name,
+			"cooldown", res.Cooldown.Duration,
 		).InfoContext(ctx, "Registering handler")
-		v1Touch.PUT(name+"/:namespace/:name", handleTouch(client, res))
+		v1Touch.PUT(
+			name+"/:namespace/:name",
+			rateLimit(limits, cd, name, res),
+			handleTouch(client, notifier, events, name, res, opts.Config.Retry),
+		)
+		v1Touch.GET(name+"/:namespace/:name", handleState(client, name, res))
+		v1Touch.GET(name+"/:namespace/:name/events/:streamId", handleEvents(events))
 	}
 
-	return start(ctx, router)
+	return start(ctx, opts.Config.Server, router, admin)
 }
 
 func validateArgocdHeaders() gin.HandlerFunc {
@@ -84,11 +150,11 @@ func validateArgocdHeaders() gin.HandlerFunc {
 		if !ok {
 			return
 		}
-		if !strings.HasPrefix(c.Request.URL.Path, fmt.Sprintf("%s%s/%s/", APIPathV1, apiPatchTouch, extName)) {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "Invalid extension name: " + extName,
-			})
-			c.Abort()
+		// a batch is validated per item, as it has no resource in the path
+		isBatch := c.Request.URL.Path == APIPathV1+apiPatchTouch+apiPathBatch
+		if !isBatch && !strings.HasPrefix(c.Request.URL.Path, fmt.Sprintf("%s%s/%s/", APIPathV1, apiPatchTouch, extName)) {
+			abortWithError(c, http.StatusBadRequest, ErrorCodeInvalidExtensionName, "Invalid extension name: "+extName, nil)
+			return
 		}
 		c.Next()
 	}
@@ -97,30 +163,52 @@ func validateArgocdHeaders() gin.HandlerFunc {
 func validateHeader(c *gin.Context, name string) (bool, string) {
 	header := c.GetHeader(name)
 	if header == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Missing required header: " + name,
-		})
-		c.Abort()
+		abortWithError(c, http.StatusBadRequest, ErrorCodeMissingHeader, "Missing required header: "+name, nil)
 		return false, ""
 	}
 	return true, header
 }
 
-func start(ctx context.Context, router *gin.Engine) error {
-	slog.With("port", ":8080", "version", version.Version, "build", version.Build).
-		InfoContext(ctx, "Starting server")
+// start serves the public router and the admin router, if not nil, until the process is terminated.
+func start(ctx context.Context, cfg config.Server, router, admin *gin.Engine) error {
+	addr := cfg.ListenAddress
+	if addr == "" {
+		addr = defaultListenAddress
+	}
+	slog.With(
+		"address", addr,
+		"adminAddress", cfg.AdminAddress,
+		"tls", cfg.TLS.Enabled(),
+		"clientCertificates", cfg.TLS.ClientCAFile != "",
+		"version", version.Version,
+		"build", version.Build,
+	).InfoContext(ctx, "Starting server")
 	srv := &http.Server{
-		Addr:    ":8080",
+		Addr:    addr,
 		Handler: router,
 	}
+	servers := []*http.Server{srv}
+
+	listenCtx, stopListen := context.WithCancel(ctx)
+	defer stopListen()
 
 	quit := make(chan os.Signal, 1)
-	go func() {
-		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			slog.ErrorContext(ctx, "Error starting server", "error", err)
+	serve := func(name string, run func() error) {
+		if err := run(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.ErrorContext(ctx, "Error starting server", "server", name, "error", err)
 			quit <- syscall.SIGTERM
 		}
-	}()
+	}
+	go serve("public", func() error { return listen(listenCtx, srv, cfg.TLS) })
+
+	if admin != nil {
+		adminSrv := &http.Server{
+			Addr:    cfg.AdminAddress,
+			Handler: admin,
+		}
+		servers = append(servers, adminSrv)
+		go serve("admin", adminSrv.ListenAndServe)
+	}
 
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
@@ -129,39 +217,218 @@ func start(ctx context.Context, router *gin.Engine) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	if err := srv.Shutdown(ctx); err != nil {
-		return fmt.Errorf("server forced to shutdown: %w", err)
+	for _, s := range servers {
+		if err := s.Shutdown(ctx); err != nil {
+			return fmt.Errorf("server forced to shutdown: %w", err)
+		}
 	}
 
 	slog.InfoContext(ctx, "Server exiting")
 	return nil
 }
 
-func handleTouch(cl k8s.Client, res config.Resource) gin.HandlerFunc {
+func handleTouch(
+	cl k8s.Client,
+	notifier notify.Notifier,
+	events *broker,
+	key string,
+	res config.Resource,
+	retry config.Retry,
+) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		namespace := c.Param("namespace")
 		name := c.Param("name")
+		dryRun := c.GetBool(contextKeyDryRun)
 
-		l := slog.With("resource", res.Name, "namespace", namespace, "name", name)
+		l := slog.With(
+			"resource", res.Name,
+			"namespace", namespace,
+			"name", name,
+			"dryRun", dryRun,
+			"requestId", c.GetString(contextKeyRequestID),
+		)
 
-		value := metav1.Now().Format(time.RFC3339)
-		if user := c.GetHeader(headerArgoCDUsername); user != "" {
-			value += " by: " + user
+		user := c.GetHeader(headerArgoCDUsername)
+		if user != "" {
 			l = l.With("user", user)
 		}
 
-		if err := cl.PatchAnnotation(c, res, namespace, name, "argocd.bakito.ch/touch", value); err != nil {
-			l.ErrorContext(c, "Failed to touch resource", "error", err)
-			var se *kerr.StatusError
-			if errors.As(err, &se) {
-				c.JSON(int(se.Status().Code), err)
+		streamID := events.create(user)
+		if streamID != "" {
+			c.Header(headerEventStreamID, streamID)
+		}
+
+		event := touchEvent(c, key, res, namespace, name, user)
+		result, err := touchObject(c, cl, notifier, l, key, res, event, k8s.TouchOptions{DryRun: dryRun, Retry: retry})
+		if err != nil {
+			events.publish(streamID, EventFailed, err.Error(), nil)
+			abortWithKubernetesError(c, err)
+			return
+		}
+		obj := result.Object
+
+		resp := TouchResponse{
+			DryRun:          dryRun,
+			Attempts:        result.Attempts,
+			ResourceVersion: obj.GetResourceVersion(),
+			Metadata:        obj.Object["metadata"],
+			EventStream:     streamID,
+		}
+		events.publish(streamID, EventPatched, "Annotation added", gin.H{"resourceVersion": obj.GetResourceVersion()})
+
+		if !dryRun && res.WaitFor != nil && c.Query("wait") != "false" {
+			// the touch succeeded, send the headers so the client can subscribe to the stream while waiting
+			c.Status(http.StatusOK)
+			c.Writer.WriteHeaderNow()
+			c.Writer.Flush()
+
+			events.publish(streamID, EventWatching, "Waiting for reconcile", nil)
+			start := time.Now()
+			ws, err := k8s.WaitForReconcile(c, cl, res, obj, func(msg string) {
+				events.publish(streamID, EventChanged, msg, nil)
+			})
+			if err != nil {
+				// the touch itself succeeded, only the wait is reported as failed
+				l.ErrorContext(c, "Failed to wait for reconcile", "error", err)
+				ws = k8s.WaitStatus{
+					Result:          k8s.WaitResultFailed,
+					Message:         "Failed to wait for reconcile: " + err.Error(),
+					ResourceVersion: obj.GetResourceVersion(),
+					Duration:        time.Since(start).Round(time.Millisecond).String(),
+				}
+				if errors.Is(err, context.DeadlineExceeded) {
+					ws.Result = k8s.WaitResultTimeout
+				}
+			}
+			l.With("result", ws.Result, "message", ws.Message).InfoContext(c, "Waited for reconcile")
+			waitsTotal.WithLabelValues(key, string(ws.Result)).Inc()
+			resp.Wait = &ws
+		}
+
+		final, msg := EventDone, "Touched"
+		if resp.Wait != nil {
+			msg = resp.Wait.Message
+			if resp.Wait.Result != k8s.WaitResultReconciled {
+				final = EventFailed
+			}
+		}
+		events.publish(streamID, final, msg, resp)
+
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// touchEvent returns the notification event of a touch requested through the Argo CD proxy.
+func touchEvent(c *gin.Context, key string, res config.Resource, namespace, name, user string) notify.Event {
+	return notify.Event{
+		Resource:    key,
+		Group:       res.Group,
+		Version:     res.Version,
+		Kind:        res.Kind,
+		Namespace:   namespace,
+		Name:        name,
+		User:        user,
+		Application: c.GetHeader(headerArgocdAppName),
+		Project:     c.GetHeader(headerArgocdProjName),
+		Time:        now(),
+	}
+}
+
+// touchObject touches the object of the event, records the metrics and notifies the targets of the resource.
+func touchObject(
+	ctx context.Context,
+	cl k8s.Client,
+	notifier notify.Notifier,
+	l *slog.Logger,
+	key string,
+	res config.Resource,
+	event notify.Event,
+	opts k8s.TouchOptions,
+) (k8s.TouchResult, error) {
+	result, err := k8s.Touch(ctx, cl, res, event.Namespace, event.Name, event.User, opts)
+	touchesTotal.WithLabelValues(key, touchResult(err), strconv.FormatBool(opts.DryRun)).Inc()
+	l = l.With("attempts", result.Attempts)
+	if err != nil {
+		l.ErrorContext(ctx, "Failed to touch resource", "error", err)
+		event.Error = err.Error()
+	} else {
+		l.InfoContext(ctx, "Resource touched")
+		event.Success = true
+	}
+	if !opts.DryRun {
+		notifier.Notify(ctx, res.Notify, event)
+	}
+	return result, err
+}
+
+// TouchResponse is returned after touching an object.
+type TouchResponse struct {
+	DryRun bool `json:"dryRun"`
+	// Attempts is the number of patch attempts, more than one if transient errors or conflicts were retried.
+	Attempts int `json:"attempts"`
+	// ResourceVersion of the object after the touch.
+	ResourceVersion string `json:"resourceVersion"`
+	// Metadata of the touched object, or the object as it would be patched in dry run mode.
+	Metadata any `json:"metadata"`
+	// Wait is the outcome of waiting for the reconciliation, if configured for the resource.
+	Wait *k8s.WaitStatus `json:"wait,omitempty"`
+	// EventStream is the ID of the event stream of the touch, also returned in the X-Event-Stream-Id header.
+	// It is empty if the touch has no user.
+	EventStream string `json:"eventStream,omitempty"`
+}
+
+// parseDryRun marks the request as dry run if enabled globally or requested with the dryRun query parameter.
+func parseDryRun(global bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dryRun := global
+		if q := c.Query("dryRun"); q != "" {
+			v, err := strconv.ParseBool(q)
+			if err != nil {
+				abortWithError(c, http.StatusBadRequest, ErrorCodeInvalidParameter, "Invalid dryRun parameter: "+q, nil)
 				return
 			}
-			c.JSON(http.StatusBadRequest, err)
+			dryRun = dryRun || v
+		}
+		c.Set(contextKeyDryRun, dryRun)
+		c.Next()
+	}
+}
+
+// StatusResponse is the state of this replica.
+type StatusResponse struct {
+	Version string        `json:"version"`
+	Leader  leader.Status `json:"leader"`
+}
+
+func handleStatus(elector *leader.Elector) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, StatusResponse{Version: version.Version, Leader: elector.Status()})
+	}
+}
+
+// StateResponse is the touch state of an object.
+type StateResponse struct {
+	k8s.TouchState
+	Resource string `json:"resource"`
+	Group    string `json:"group"`
+	Version  string `json:"version"`
+	Kind     string `json:"kind"`
+}
+
+func handleState(cl k8s.Client, key string, res config.Resource) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		obj, err := cl.Get(c, res, c.Param("namespace"), c.Param("name"))
+		if err != nil {
+			abortWithKubernetesError(c, err)
 			return
 		}
-		l.InfoContext(c, "Resource touched")
 
-		c.Status(http.StatusOK)
+		c.JSON(http.StatusOK, StateResponse{
+			TouchState: k8s.StateOf(obj),
+			Resource:   key,
+			Group:      res.Group,
+			Version:    res.Version,
+			Kind:       res.Kind,
+		})
 	}
 }
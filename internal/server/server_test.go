@@ -1,12 +1,21 @@
 package server
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/bakito/argocd-touch-extension/internal/config"
+	"github.com/bakito/argocd-touch-extension/internal/k8s"
+	"github.com/bakito/argocd-touch-extension/internal/leader"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 func TestValidateArgocdHeaders(t *testing.T) {
@@ -97,3 +106,126 @@ func TestValidateArgocdHeaders(t *testing.T) {
 		})
 	}
 }
+
+func TestParseDryRun(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		global         bool
+		query          string
+		expectedCode   int
+		expectedDryRun bool
+	}{
+		{name: "disabled", expectedCode: http.StatusOK},
+		{name: "global", global: true, expectedCode: http.StatusOK, expectedDryRun: true},
+		{name: "query", query: "?dryRun=true", expectedCode: http.StatusOK, expectedDryRun: true},
+		{
+			name:           "query can not disable global",
+			global:         true,
+			query:          "?dryRun=false",
+			expectedCode:   http.StatusOK,
+			expectedDryRun: true,
+		},
+		{name: "invalid query", query: "?dryRun=maybe", expectedCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dryRun bool
+			router := gin.New()
+			router.PUT("/", parseDryRun(tt.global), func(c *gin.Context) {
+				dryRun = c.GetBool(contextKeyDryRun)
+				c.Status(http.StatusOK)
+			})
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/"+tt.query, http.NoBody))
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+			assert.Equal(t, tt.expectedDryRun, dryRun)
+		})
+	}
+}
+
+func TestHandleState(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cl := newFakeClient(newObject("default", "test", map[string]string{
+		k8s.AnnotationTouch: "2025-01-02T03:04:05Z by: alice",
+	}))
+	res := config.Resource{Version: "v1", Kind: "ConfigMap", Name: "configmaps"}
+
+	router := gin.New()
+	router.GET("/cm/:namespace/:name", handleState(cl, "cm", res))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cm/default/test", http.NoBody))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var state StateResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &state))
+	assert.Equal(t, "cm", state.Resource)
+	assert.Equal(t, "ConfigMap", state.Kind)
+	assert.Equal(t, "test", state.Name)
+	require.NotNil(t, state.LastTouch)
+	assert.Equal(t, "alice", state.LastTouch.User)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cm/default/missing", http.NoBody))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHandleStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/status", handleStatus(leader.New(config.LeaderElection{})))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", http.NoBody))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp StatusResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.False(t, resp.Leader.Enabled)
+	assert.True(t, resp.Leader.Leader, "all replicas lead without leader election")
+	assert.NotEmpty(t, resp.Leader.Identity)
+}
+
+func TestHandleTouchWaitFailed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cl := newFakeClient(newObject("default", "test", nil))
+	cl.watchErr = kerr.NewForbidden(schema.GroupResource{Resource: "configmaps"}, "test", errors.New("denied"))
+	res := config.Resource{
+		Version:  "v1",
+		Kind:     "ConfigMap",
+		Name:     "configmaps",
+		Cooldown: config.Duration{Duration: time.Minute},
+		WaitFor:  &config.WaitFor{ResourceVersion: true},
+	}
+
+	router := gin.New()
+	router.PUT("/cm/:namespace/:name",
+		rateLimit(nil, newCooldown(), "cm", res),
+		handleTouch(cl, &fakeNotifier{}, newBroker(), "cm", res, config.Retry{}),
+	)
+
+	req := httptest.NewRequest(http.MethodPut, "/cm/default/test", http.NoBody)
+	req.Header.Set(headerArgoCDUsername, "alice")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, "the touch succeeded")
+
+	var resp TouchResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.NotNil(t, resp.Wait)
+	assert.Equal(t, k8s.WaitResultFailed, resp.Wait.Result)
+	assert.Contains(t, resp.Wait.Message, "denied")
+	assert.NotEmpty(t, resp.EventStream)
+	assert.Equal(t, rec.Header().Get(headerEventStreamID), resp.EventStream)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/cm/default/test", http.NoBody))
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code, "the cooldown is kept")
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/bakito/argocd-touch-extension/internal/config"
+	"github.com/fsnotify/fsnotify"
+	"github.com/gin-gonic/gin"
+)
+
+// certReloader serves the certificate and client CAs of the configured files and reloads them on change.
+type certReloader struct {
+	cfg       config.TLS
+	cert      atomic.Pointer[tls.Certificate]
+	clientCAs atomic.Pointer[x509.CertPool]
+}
+
+func newCertReloader(cfg config.TLS) (*certReloader, error) {
+	r := &certReloader{cfg: cfg}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// load reads the files, the previous certificates are kept if they are invalid.
+func (r *certReloader) load() error {
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load tls certificate: %w", err)
+	}
+	var pool *x509.CertPool
+	if r.cfg.ClientCAFile != "" {
+		data, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client ca: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("client ca %q contains no certificates", r.cfg.ClientCAFile)
+		}
+	}
+	r.cert.Store(&cert)
+	r.clientCAs.Store(pool)
+	return nil
+}
+
+// tlsConfig returns a config serving the latest loaded certificates.
+// Client certificates are verified if given, the touch API enforces them with requireClientCert.
+func (r *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert.Load()},
+			}
+			if pool := r.clientCAs.Load(); pool != nil {
+				cfg.ClientAuth = tls.VerifyClientCertIfGiven
+				cfg.ClientCAs = pool
+			}
+			return cfg, nil
+		},
+	}
+}
+
+// watch reloads the certificates when the files change until the context is done.
+// The directories are watched, as mounted secrets are updated by replacing a symlink.
+func (r *certReloader) watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	dirs := make(map[string]bool)
+	for _, f := range []string{r.cfg.CertFile, r.cfg.KeyFile, r.cfg.ClientCAFile} {
+		if f == "" || dirs[filepath.Dir(f)] {
+			continue
+		}
+		dirs[filepath.Dir(f)] = true
+		if err := watcher.Add(filepath.Dir(f)); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			if err := r.load(); err != nil {
+				slog.ErrorContext(ctx, "Failed to reload certificates, keeping the previous ones", "error", err)
+				continue
+			}
+			slog.InfoContext(ctx, "Reloaded certificates", "file", event.Name)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			slog.ErrorContext(ctx, "Error watching certificates", "error", err)
+		}
+	}
+}
+
+// requireClientCert rejects requests without a verified client certificate.
+func requireClientCert() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 {
+			abortWithError(c, http.StatusUnauthorized, ErrorCodeClientCertificateRequired,
+				"A valid client certificate is required", nil)
+			return
+		}
+		c.Next()
+	}
+}
+
+// listen serves the router with tls if configured.
+func listen(ctx context.Context, srv *http.Server, cfg config.TLS) error {
+	if !cfg.Enabled() {
+		return srv.ListenAndServe()
+	}
+
+	r, err := newCertReloader(cfg)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := r.watch(ctx); err != nil {
+			slog.ErrorContext(ctx, "Certificates are not reloaded", "error", err)
+		}
+	}()
+
+	srv.TLSConfig = r.tlsConfig()
+	return srv.ListenAndServeTLS("", "")
+}